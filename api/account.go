@@ -0,0 +1,340 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+// What happens to an account once its deletion grace period is over.
+const (
+	// AccountDeletionHard removes the user row, the foreign keys cascade to their posts and everything else.
+	AccountDeletionHard = "delete"
+	// AccountDeletionAnonymize scrubs the personal data but keeps the authored posts under a placeholder name.
+	AccountDeletionAnonymize = "anonymize"
+)
+
+const (
+	defaultAccountDeletionGracePeriod = 30 * 24 * time.Hour
+	accountPurgeBatchSize             = 100
+)
+
+// accountExport is everything we hold about a user, as handed out by the export endpoint.
+// Secrets and their hashes stay out of it.
+type accountExport struct {
+	ExportedAt  time.Time            `json:"exported_at"`
+	Profile     userResponse         `json:"profile"`
+	Posts       []repo.Post          `json:"posts"`
+	Comments    []repo.Comment       `json:"comments"`
+	Reactions   []repo.PostReaction  `json:"reactions"`
+	Invitations []invitationResponse `json:"invitations"`
+	Sessions    []sessionExport      `json:"sessions"`
+	Identities  []identityExport     `json:"identities"`
+	APIKeys     []apiKeyResponse     `json:"api_keys"`
+	TwoFactor   twoFactorExport      `json:"two_factor"`
+}
+
+// sessionExport is a login from one device, including the ones that ended.
+type sessionExport struct {
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// identityExport is an SSO account linked to the user.
+type identityExport struct {
+	Issuer      string    `json:"issuer"`
+	Subject     string    `json:"subject"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+type twoFactorExport struct {
+	Enabled bool `json:"enabled"`
+}
+
+// export the caller's data
+type exportAccountRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=json zip"`
+}
+
+func (server *Server) exportAccount(c *gin.Context) {
+	var req exportAccountRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := server.currentUser(c)
+	if !ok {
+		return
+	}
+
+	posts, err := server.store.ListPostsByUser(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve posts"})
+		return
+	}
+	comments, err := server.store.ListCommentsByUser(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve comments"})
+		return
+	}
+	reactions, err := server.store.ListPostReactionsByUser(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve reactions"})
+		return
+	}
+	invitations, err := server.store.ListInvitationsByCreator(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve invitations"})
+		return
+	}
+	sessions, err := server.store.ListLoginSessionsByUser(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve sessions"})
+		return
+	}
+	identities, err := server.store.ListUserIdentitiesByUser(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve identities"})
+		return
+	}
+	apiKeys, err := server.store.ListAPIKeysByUser(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve API keys"})
+		return
+	}
+	totpEnabled, err := server.totpEnabled(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve two-factor status"})
+		return
+	}
+
+	export := accountExport{
+		ExportedAt:  time.Now(),
+		Profile:     newUserResponse(user),
+		Posts:       posts,
+		Comments:    comments,
+		Reactions:   reactions,
+		Invitations: make([]invitationResponse, 0, len(invitations)),
+		Sessions:    make([]sessionExport, 0, len(sessions)),
+		Identities:  make([]identityExport, 0, len(identities)),
+		APIKeys:     make([]apiKeyResponse, 0, len(apiKeys)),
+		TwoFactor:   twoFactorExport{Enabled: totpEnabled},
+	}
+	for _, invitation := range invitations {
+		export.Invitations = append(export.Invitations, newInvitationResponse(invitation))
+	}
+	for _, session := range sessions {
+		export.Sessions = append(export.Sessions, sessionExport{
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IpAddress,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			RevokedAt:  timestampPtr(session.RevokedAt),
+		})
+	}
+	for _, identity := range identities {
+		export.Identities = append(export.Identities, identityExport{
+			Issuer:      identity.Issuer,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			CreatedAt:   identity.CreatedAt,
+			LastLoginAt: identity.LastLoginAt,
+		})
+	}
+	for _, apiKey := range apiKeys {
+		export.APIKeys = append(export.APIKeys, newAPIKeyResponse(apiKey))
+	}
+
+	filename := fmt.Sprintf("ikniteconnect-export-%s-%s", user.Username, export.ExportedAt.Format("20060102"))
+	if req.Format != "zip" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".json"))
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".zip"))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	if err := writeExportZip(c.Writer, export); err != nil {
+		// the status is already sent, all we can do is record the failure
+		_ = c.Error(err)
+	}
+}
+
+// writeExportZip writes one JSON file per section of the export.
+func writeExportZip(w http.ResponseWriter, export accountExport) error {
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"posts.json", export.Posts},
+		{"comments.json", export.Comments},
+		{"reactions.json", export.Reactions},
+		{"invitations.json", export.Invitations},
+		{"sessions.json", export.Sessions},
+		{"identities.json", export.Identities},
+		{"api_keys.json", export.APIKeys},
+		{"two_factor.json", export.TwoFactor},
+	}
+
+	for _, file := range files {
+		f, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// request the deletion of the caller's account, it happens once the grace period is over.
+// An account without a password confirms it right after logging in
+type deleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+func (server *Server) requestAccountDeletion(c *gin.Context) {
+	var req deleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := server.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !server.reauthenticate(c, user, req.Password) {
+		return
+	}
+
+	user, err := server.store.ScheduleUserDeletion(c, repo.ScheduleUserDeletionParams{
+		ID:                  user.ID,
+		DeletionScheduledAt: pgtype.Timestamptz{Time: time.Now().Add(server.AccountDeletionGracePeriod), Valid: true},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to schedule deletion"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":               "Account deletion scheduled, you can cancel it until then",
+		"deletion_scheduled_at": user.DeletionScheduledAt.Time,
+	})
+}
+
+// cancel a scheduled deletion
+func (server *Server) cancelAccountDeletion(c *gin.Context) {
+	rows, err := server.store.CancelUserDeletion(c, authClaims(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel deletion"})
+		return
+	}
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no deletion is scheduled"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+}
+
+// PurgeDeletedAccounts deletes or anonymizes the accounts whose grace period is over,
+// then again every interval until ctx is done.
+func (server *Server) PurgeDeletedAccounts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := server.purgeDueAccounts(ctx); err != nil {
+			log.Printf("account purge failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (server *Server) purgeDueAccounts(ctx context.Context) error {
+	for {
+		users, err := server.store.ListUsersDueForDeletion(ctx, accountPurgeBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			return nil
+		}
+
+		for _, user := range users {
+			if err := server.purgeAccount(ctx, user); err != nil {
+				return fmt.Errorf("user %d: %w", user.ID, err)
+			}
+		}
+	}
+}
+
+func (server *Server) purgeAccount(ctx context.Context, user repo.User) error {
+	if server.AccountDeletionMode != AccountDeletionAnonymize {
+		return server.store.DeleteUser(ctx, user.ID)
+	}
+
+	// the row stays, so everything tied to the person has to go by hand, all of it or nothing
+	err := server.inTx(ctx, func(q *repo.Queries) error {
+		if err := q.AnonymizeUser(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := q.RevokeUserSessions(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := q.RevokeUserAPIKeys(ctx, user.ID); err != nil {
+			return err
+		}
+		// the devices list holds IP addresses and user agents
+		if err := q.DeleteUserLoginSessions(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := q.DeleteUserIdentities(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := q.DeleteTOTPCredential(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := q.DeleteRecoveryCodes(ctx, user.ID); err != nil {
+			return err
+		}
+		return q.DeleteLoginThrottle(ctx, accountThrottleKey(user.Email))
+	})
+	if err != nil {
+		return err
+	}
+	return server.revocations.revokeAllBefore(ctx, user.ID, time.Now())
+}
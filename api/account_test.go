@@ -0,0 +1,256 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+// newExportServer returns a server holding one of everything for testUser, each secret set to
+// a value the test can look for in the export.
+func newExportServer(t *testing.T) (*Server, *fakeDB) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	now := time.Now()
+	user := verifiedUser
+	user.HashedPassword = "password-hash-value"
+	db.returns("GetUser", user, nil)
+	db.returns("ListPostsByUser", []repo.Post{{ID: 1, Title: "Hello", Content: "World", UserID: user.ID, CreatedAt: now}}, nil)
+	db.returns("ListCommentsByUser", []repo.Comment{}, nil)
+	db.returns("ListPostReactionsByUser", []repo.PostReaction{
+		{PostID: 1, UserID: user.ID, Reaction: "like", CreatedAt: now},
+		{PostID: 3, UserID: user.ID, Reaction: "celebrate", CreatedAt: now.Add(-time.Hour)},
+	}, nil)
+	db.returns("ListInvitationsByCreator", []repo.Invitation{}, nil)
+	db.returns("ListLoginSessionsByUser", []repo.LoginSession{
+		{ID: 2, UserID: user.ID, FamilyID: "family-id-value", UserAgent: "Firefox", IpAddress: "192.0.2.1", CreatedAt: now, LastSeenAt: now},
+		{ID: 1, UserID: user.ID, FamilyID: "old-family-id-value", UserAgent: "curl", IpAddress: "192.0.2.2", CreatedAt: now.Add(-time.Hour), LastSeenAt: now.Add(-time.Hour), RevokedAt: pgtype.Timestamptz{Time: now, Valid: true}},
+	}, nil)
+	db.returns("ListUserIdentitiesByUser", []repo.UserIdentity{
+		{ID: 1, UserID: user.ID, Issuer: "https://accounts.example.com", Subject: "subject-1", Email: user.Email, CreatedAt: now, LastLoginAt: now},
+	}, nil)
+	db.returns("ListAPIKeysByUser", []repo.APIKey{
+		{ID: 1, UserID: user.ID, Name: "ci", Prefix: "abcd1234", SecretHash: "api-key-hash-value", Scopes: []string{"posts:read"}, LastUsedAt: pgtype.Timestamptz{Time: now, Valid: true}, CreatedAt: now},
+	}, nil)
+	db.returns("GetTOTPCredential", repo.TotpCredential{UserID: user.ID, Secret: "totp-secret-value", EnabledAt: pgtype.Timestamptz{Time: now, Valid: true}, CreatedAt: now}, nil)
+	return server, db
+}
+
+func TestExportAccount(t *testing.T) {
+	server, _ := newExportServer(t)
+
+	rec := serve(server, http.MethodGet, "/me/export", "", accessToken(t, server, testUser, "family"))
+	expectStatus(t, rec, http.StatusOK)
+	for _, secret := range []string{"password-hash-value", "family-id-value", "api-key-hash-value", "totp-secret-value"} {
+		if strings.Contains(rec.Body.String(), secret) {
+			t.Errorf("the export contains %s: %s", secret, rec.Body.String())
+		}
+	}
+
+	var export map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &export); err != nil {
+		t.Fatal(err)
+	}
+	var sections []string
+	for section := range export {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	want := "api_keys comments exported_at identities invitations posts profile reactions sessions two_factor"
+	if got := strings.Join(sections, " "); got != want {
+		t.Errorf("sections = %s, want %s", got, want)
+	}
+
+	var reactions []repo.PostReaction
+	if err := json.Unmarshal(export["reactions"], &reactions); err != nil {
+		t.Fatal(err)
+	}
+	if len(reactions) != 2 || reactions[0].PostID != 1 || reactions[0].Reaction != "like" || reactions[1].Reaction != "celebrate" || reactions[1].CreatedAt.IsZero() {
+		t.Errorf("reactions = %+v", reactions)
+	}
+	var sessions []sessionExport
+	if err := json.Unmarshal(export["sessions"], &sessions); err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].IPAddress != "192.0.2.1" || sessions[0].UserAgent != "Firefox" || sessions[0].RevokedAt != nil || sessions[1].RevokedAt == nil {
+		t.Errorf("sessions = %+v, want both, the ended one included", sessions)
+	}
+	var identities []identityExport
+	if err := json.Unmarshal(export["identities"], &identities); err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 || identities[0].Issuer != "https://accounts.example.com" || identities[0].Subject != "subject-1" {
+		t.Errorf("identities = %+v", identities)
+	}
+	var apiKeys []apiKeyResponse
+	if err := json.Unmarshal(export["api_keys"], &apiKeys); err != nil {
+		t.Fatal(err)
+	}
+	if len(apiKeys) != 1 || apiKeys[0].Name != "ci" || len(apiKeys[0].Scopes) != 1 || apiKeys[0].LastUsedAt == nil || apiKeys[0].Key != "" {
+		t.Errorf("api_keys = %+v", apiKeys)
+	}
+	if string(export["two_factor"]) != `{"enabled":true}` {
+		t.Errorf("two_factor = %s", export["two_factor"])
+	}
+}
+
+func TestExportAccountAsZip(t *testing.T) {
+	server, _ := newExportServer(t)
+
+	rec := serve(server, http.MethodGet, "/me/export?format=zip", "", accessToken(t, server, testUser, "family"))
+	expectStatus(t, rec, http.StatusOK)
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, f := range archive.File {
+		files = append(files, f.Name)
+	}
+	want := "profile.json posts.json comments.json reactions.json invitations.json sessions.json identities.json api_keys.json two_factor.json"
+	if got := strings.Join(files, " "); got != want {
+		t.Errorf("files = %s, want %s", got, want)
+	}
+}
+
+func TestRequestAccountDeletion(t *testing.T) {
+	server, db := newPasswordChangeServer(t)
+	db.on("ScheduleUserDeletion", func(args ...interface{}) (interface{}, error) {
+		return repo.User{ID: args[0].(int32), DeletionScheduledAt: args[1].(pgtype.Timestamptz)}, nil
+	})
+	token := accessToken(t, server, testUser, "family")
+
+	expectStatus(t, serve(server, http.MethodPost, "/me/delete", `{"password": "wrong"}`, token), http.StatusForbidden)
+	expectStatus(t, serve(server, http.MethodPost, "/me/delete", `{}`, token), http.StatusForbidden)
+	expectStatus(t, serve(server, http.MethodPost, "/me/delete", `{"password": "correct horse"}`, token), http.StatusAccepted)
+
+	scheduled := db.called("ScheduleUserDeletion")
+	if len(scheduled) != 1 || scheduled[0][0] != testUser.ID {
+		t.Fatalf("ScheduleUserDeletion calls = %v, want one for the caller", scheduled)
+	}
+	at := scheduled[0][1].(pgtype.Timestamptz).Time
+	if want := time.Now().Add(server.AccountDeletionGracePeriod); at.Before(want.Add(-time.Minute)) || at.After(want) {
+		t.Errorf("deletion scheduled at %s, want after the grace period", at)
+	}
+}
+
+func TestRequestAccountDeletionWithoutPassword(t *testing.T) {
+	t.Run("just logged in", func(t *testing.T) {
+		server, db := newPasswordlessServer(t, time.Now().Add(-time.Minute))
+		db.returns("ScheduleUserDeletion", testUser, nil)
+
+		expectStatus(t, serve(server, http.MethodPost, "/me/delete", `{}`, accessToken(t, server, testUser, "family")), http.StatusAccepted)
+	})
+
+	t.Run("logged in long ago", func(t *testing.T) {
+		server, db := newPasswordlessServer(t, time.Now().Add(-time.Hour))
+
+		expectStatus(t, serve(server, http.MethodPost, "/me/delete", `{}`, accessToken(t, server, testUser, "family")), http.StatusForbidden)
+		if len(db.called("ScheduleUserDeletion")) != 0 {
+			t.Error("the deletion was scheduled")
+		}
+	})
+}
+
+func TestCancelAccountDeletion(t *testing.T) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	scheduled := true
+	db.on("CancelUserDeletion", func(args ...interface{}) (interface{}, error) {
+		if !scheduled {
+			return int64(0), nil
+		}
+		scheduled = false
+		return int64(1), nil
+	})
+	token := accessToken(t, server, testUser, "family")
+
+	expectStatus(t, serve(server, http.MethodPost, "/me/delete/cancel", "", token), http.StatusOK)
+	expectStatus(t, serve(server, http.MethodPost, "/me/delete/cancel", "", token), http.StatusNotFound)
+	if calls := db.called("CancelUserDeletion"); len(calls) != 2 || calls[0][0] != testUser.ID {
+		t.Errorf("CancelUserDeletion calls = %v", calls)
+	}
+}
+
+// newPurgeServer returns a server where testUser's grace period is over, in the given deletion mode.
+func newPurgeServer(t *testing.T, mode string) (*Server, *fakeDB) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	server.AccountDeletionMode = mode
+	due := []repo.User{testUser}
+	db.on("ListUsersDueForDeletion", func(args ...interface{}) (interface{}, error) {
+		users := due
+		due = []repo.User{}
+		return users, nil
+	})
+	for _, name := range []string{"DeleteUser", "AnonymizeUser", "RevokeUserSessions", "RevokeUserAPIKeys", "DeleteUserLoginSessions",
+		"DeleteUserIdentities", "DeleteTOTPCredential", "DeleteRecoveryCodes", "DeleteLoginThrottle"} {
+		db.returns(name, nil, nil)
+	}
+	return server, db
+}
+
+func TestPurgeDeletesAccounts(t *testing.T) {
+	server, db := newPurgeServer(t, AccountDeletionHard)
+
+	if err := server.purgeDueAccounts(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if deleted := db.called("DeleteUser"); len(deleted) != 1 || deleted[0][0] != testUser.ID {
+		t.Errorf("DeleteUser calls = %v", deleted)
+	}
+	if len(db.called("AnonymizeUser")) != 0 {
+		t.Error("the account was anonymized")
+	}
+}
+
+func TestPurgeAnonymizesAccounts(t *testing.T) {
+	server, db := newPurgeServer(t, AccountDeletionAnonymize)
+
+	if err := server.purgeDueAccounts(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"AnonymizeUser", "RevokeUserSessions", "RevokeUserAPIKeys", "DeleteUserLoginSessions",
+		"DeleteUserIdentities", "DeleteTOTPCredential", "DeleteRecoveryCodes", "SetTokensValidAfter"} {
+		if calls := db.called(name); len(calls) != 1 || calls[0][0] != testUser.ID {
+			t.Errorf("%s calls = %v, want one for the user", name, calls)
+		}
+	}
+	if calls := db.called("DeleteLoginThrottle"); len(calls) != 1 || calls[0][0] != accountThrottleKey(testUser.Email) {
+		t.Errorf("DeleteLoginThrottle calls = %v", calls)
+	}
+	if len(db.called("commit")) != 1 {
+		t.Error("the anonymization was not committed")
+	}
+	if len(db.called("DeleteUser")) != 0 {
+		t.Error("the account was deleted")
+	}
+}
+
+func TestPurgeAnonymizeRollsBack(t *testing.T) {
+	server, db := newPurgeServer(t, AccountDeletionAnonymize)
+	db.returns("DeleteUserLoginSessions", nil, errors.New("connection reset"))
+
+	// a half anonymized account is not left behind, the next run tries it again
+	if err := server.purgeDueAccounts(context.Background()); err == nil {
+		t.Fatal("the purge succeeded")
+	}
+	if len(db.called("rollback")) != 1 || len(db.called("commit")) != 0 {
+		t.Error("the anonymization was not rolled back")
+	}
+	if len(db.called("SetTokensValidAfter")) != 0 {
+		t.Error("the purge went on after the rollback")
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+// withRole returns testUser with the given role.
+func withRole(role string) repo.User {
+	user := testUser
+	user.Role = role
+	return user
+}
+
+func TestRoutesRequireRole(t *testing.T) {
+	routes := []struct {
+		method, target, body string
+		allowed              []string
+	}{
+		{method: http.MethodDelete, target: "/admin/posts/1", allowed: []string{RoleModerator, RoleAdmin}},
+		{method: http.MethodDelete, target: "/admin/comments/1", allowed: []string{RoleModerator, RoleAdmin}},
+		{method: http.MethodGet, target: "/admin/users?page_id=1&page_size=5", allowed: []string{RoleAdmin}},
+		{method: http.MethodPatch, target: "/admin/users/8/role", body: `{"role": "moderator"}`, allowed: []string{RoleAdmin}},
+		{method: http.MethodDelete, target: "/admin/users/8", allowed: []string{RoleAdmin}},
+		{method: http.MethodGet, target: "/invitations", allowed: []string{RoleAdmin}},
+	}
+	for _, route := range routes {
+		for _, role := range []string{RoleMember, RoleModerator, RoleAdmin} {
+			t.Run(route.method+" "+route.target+" as "+role, func(t *testing.T) {
+				server, db := newTestServer(t)
+				newFakeRevocations(db)
+				db.returns("DeleteAnyPost", int64(1), nil)
+				db.returns("DeleteAnyComment", int64(1), nil)
+				db.returns("ListUsers", []repo.User{}, nil)
+				db.returns("UpdateUserRole", repo.User{ID: 8, Role: RoleModerator}, nil)
+				db.returns("DeleteUser", nil, nil)
+				db.returns("ListInvitationsByCreator", []repo.Invitation{}, nil)
+
+				want := http.StatusForbidden
+				for _, allowed := range route.allowed {
+					if role == allowed {
+						want = http.StatusOK
+					}
+				}
+				expectStatus(t, serve(server, route.method, route.target, route.body, accessToken(t, server, withRole(role), "family")), want)
+			})
+		}
+	}
+}
+
+func TestUpdateUserRoleRevokesTokens(t *testing.T) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	db.on("UpdateUserRole", func(args ...interface{}) (interface{}, error) {
+		return repo.User{ID: args[0].(int32), Username: "bob", Role: args[1].(string)}, nil
+	})
+	token := accessToken(t, server, withRole(RoleAdmin), "family")
+
+	expectStatus(t, serve(server, http.MethodPatch, "/admin/users/8/role", `{"role": "moderator"}`, token), http.StatusOK)
+
+	// the old role is in the user's tokens until they refresh
+	revoked := db.called("SetTokensValidAfter")
+	if len(revoked) != 1 || revoked[0][0] != int32(8) || !revoked[0][1].(pgtype.Timestamptz).Valid {
+		t.Errorf("SetTokensValidAfter calls = %v, want one for user 8", revoked)
+	}
+
+	expectStatus(t, serve(server, http.MethodPatch, "/admin/users/8/role", `{"role": "owner"}`, token), http.StatusBadRequest)
+	// an admin cannot demote themselves and leave nobody in charge
+	expectStatus(t, serve(server, http.MethodPatch, "/admin/users/7/role", `{"role": "member"}`, token), http.StatusBadRequest)
+	if len(db.called("UpdateUserRole")) != 1 {
+		t.Error("a refused role change reached the database")
+	}
+}
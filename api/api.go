@@ -1,75 +1,243 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/Iknite-Space/sqlc-example-api/db/postquery"
 	"github.com/Iknite-Space/sqlc-example-api/db/repo"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/Iknite-Space/sqlc-example-api/mailer"
+	"github.com/Iknite-Space/sqlc-example-api/oidc"
+	"github.com/Iknite-Space/sqlc-example-api/passwordpolicy"
 )
 
-func HashedPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashedPassword), nil
-}
-
-func CheckPassword(password string, hashedPassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-}
-
 type UserClaims struct {
 	ID       int32  `json:"id"`
 	Username string `json:"username"`
+	Role     string `json:"role"`
+	// SessionID names the login session (the refresh token family) the token was issued for
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID int32, username string, secretKey string, duration time.Duration) (string, error) {
+// newUserClaims builds the claims shared by every access token whatever it is signed with.
+func newUserClaims(issuer string, audience string, userID int32, username string, role string, sessionID string, duration time.Duration) (UserClaims, error) {
+	// every token gets a unique id so it can be revoked on logout
+	jti, err := randomToken(16)
+	if err != nil {
+		return UserClaims{}, err
+	}
+
 	claims := UserClaims{
-		ID:       userID,
-		Username: username,
+		ID:        userID,
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       jti,
+			Issuer:   issuer,
+			Audience: jwt.ClaimStrings{audience},
 			// Set token expiration relative to the current time (e.g., 1 hour)
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
+	return claims, nil
+}
 
+// GenerateToken signs the claims as an HS256 token with the shared secret, used when no KeySet is configured.
+func GenerateToken(claims UserClaims, secretKey string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	return token.SignedString([]byte(secretKey))
 }
 
+var ErrInvalidToken = errors.New("token is invalid")
+
+// VerifyToken checks the signature, expiry, issuer and audience of a token created by GenerateToken
+// and returns its claims.
+func VerifyToken(tokenString string, secretKey string, issuer string, audience string) (*UserClaims, error) {
+	claims := &UserClaims{}
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		return []byte(secretKey), nil
+	}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	return checkClaims(claims)
+}
+
+// checkClaims makes sure the claims revocation relies on are present.
+func checkClaims(claims *UserClaims) (*UserClaims, error) {
+	if claims.RegisteredClaims.ID == "" || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: missing jti or iat claim", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// generateToken signs with the key set when one is configured and falls back to the shared secret.
+func (server *Server) generateToken(userID int32, username string, role string, sessionID string, duration time.Duration) (string, error) {
+	claims, err := newUserClaims(server.JWTIssuer, server.JWTAudience, userID, username, role, sessionID, duration)
+	if err != nil {
+		return "", err
+	}
+	if server.Keys != nil {
+		return server.Keys.GenerateToken(claims)
+	}
+	return GenerateToken(claims, server.JWTSecret)
+}
+
+// verifyToken only accepts tokens signed the way generateToken signs them, by us and for us.
+func (server *Server) verifyToken(tokenString string) (*UserClaims, error) {
+	if server.Keys != nil {
+		return server.Keys.VerifyToken(tokenString, server.JWTIssuer, server.JWTAudience)
+	}
+	return VerifyToken(tokenString, server.JWTSecret, server.JWTIssuer, server.JWTAudience)
+}
+
 // server structure and API handler
 type Server struct {
-	store     *repo.Queries
-	JWTSecret string
+	store                *repo.Queries
+	DB                   Database // runs the post list and the statements that must succeed or fail together
+	revocations          *tokenRevoker
+	JWTSecret            string
+	Keys                 *KeySet
+	JWTIssuer            string // the iss claim of our tokens
+	JWTAudience          string // the aud claim of our tokens, tokens for other services are refused
+	AccessTokenDuration  time.Duration
+	RefreshTokenDuration time.Duration
+	Mailer               mailer.Mailer
+	BaseURL              string // the public URL of the API, cookies are secure when it is https
+	PasswordResetURL     string // the web app page asking for a new password, the reset token is added to its query
+	EmailVerificationURL string // the web app page confirming the email address, the verification token is added to its query
+	RequireVerifiedEmail bool   // refuse login for unverified invited accounts too, instead of flagging them
+	AllowedEmailDomains  []string
+
+	// brute-force protection on login
+	MaxLoginFailures      int32
+	MaxLoginFailuresPerIP int32
+	LoginLockoutDuration  time.Duration
+	// TrustedProxies are the proxies allowed to set X-Forwarded-For, nil trusts none
+	TrustedProxies []string
+
+	AccountDeletionGracePeriod time.Duration
+	AccountDeletionMode        string // AccountDeletionHard or AccountDeletionAnonymize
+
+	// PasswordHasher hashes new passwords, stored hashes made differently are upgraded on login
+	PasswordHasher PasswordHasher
+	PasswordPolicy *passwordpolicy.Policy
+	// OIDC enables single sign-on through the company identity provider when set
+	OIDC *oidc.Provider
+	// TOTPKey encrypts the TOTP secrets at rest, TOTPKeySize bytes
+	TOTPKey []byte
+
+	dummyHashOnce sync.Once
+	dummyHash     string
 }
 
 func NewAPIHandler(querier *repo.Queries, jwtSecret string) *Server {
 	return &Server{
-		store:     querier,
-		JWTSecret: jwtSecret,
+		store:                querier,
+		revocations:          newTokenRevoker(querier),
+		JWTSecret:            jwtSecret,
+		AccessTokenDuration:  defaultAccessTokenDuration,
+		RefreshTokenDuration: defaultRefreshTokenDuration,
+		Mailer:               mailer.NewLogMailer(os.Stdout),
+		BaseURL:              "http://localhost:8080",
+
+		MaxLoginFailures:      defaultMaxLoginFailures,
+		MaxLoginFailuresPerIP: defaultMaxLoginFailuresPerIP,
+		LoginLockoutDuration:  defaultLoginLockoutDuration,
+
+		AccountDeletionGracePeriod: defaultAccountDeletionGracePeriod,
+		AccountDeletionMode:        AccountDeletionHard,
+
+		PasswordHasher: DefaultPasswordHasher,
+		PasswordPolicy: passwordpolicy.New(),
 	}
 }
 
 func (server *Server) WireHttpHandler() http.Handler {
 	router := gin.Default()
+	// only trust X-Forwarded-For from known proxies, the client IP feeds the login throttling
+	if err := router.SetTrustedProxies(server.TrustedProxies); err != nil {
+		_ = router.SetTrustedProxies(nil)
+	}
 	//user routes
 	router.POST("/signup", server.signup)
 	router.POST("/login", server.login)
-	//post routes
-	router.POST("/post", server.createPost)
-	router.GET("/post/:id", server.getPost)
-	router.GET("/post", server.listPosts)
-	router.PUT("/posts", server.updatePost)
-	router.DELETE("/posts/:id", server.deletePost)
+	router.POST("/login/2fa", server.loginTwoFactor)
+	router.POST("/token/refresh", server.refreshToken)
+	router.GET("/.well-known/jwks.json", server.jwks)
+	router.POST("/password/forgot", server.forgotPassword)
+	router.POST("/password/reset", server.resetPassword)
+	router.POST("/verify-email", server.verifyEmail)
+	router.POST("/verify-email/resend", server.resendVerification)
+	if server.OIDC != nil {
+		router.GET("/oidc/login", server.oidcLogin)
+		router.GET("/oidc/callback", server.oidcCallback)
+	}
+	//routes below are only reachable with a valid access token
+	authRoutes := router.Group("/", server.authMiddleware())
+	authRoutes.POST("/logout", server.logout)
+	authRoutes.POST("/logout/all", server.logoutAll)
+	authRoutes.GET("/me", server.getMe)
+	authRoutes.PATCH("/me", server.updateMe)
+	authRoutes.POST("/me/password", server.changePassword)
+	authRoutes.GET("/me/export", server.exportAccount)
+	authRoutes.POST("/me/delete", server.requestAccountDeletion)
+	authRoutes.POST("/me/delete/cancel", server.cancelAccountDeletion)
+	authRoutes.POST("/2fa/totp/enroll", server.enrollTOTP)
+	authRoutes.POST("/2fa/totp/verify", server.verifyTOTPEnrollment)
+	authRoutes.POST("/2fa/totp/disable", server.disableTOTP)
+	authRoutes.POST("/invitations", requireRole(RoleAdmin), server.createInvitation)
+	authRoutes.GET("/invitations", requireRole(RoleAdmin), server.listInvitations)
+	authRoutes.GET("/me/sessions", server.listSessions)
+	authRoutes.DELETE("/me/sessions/:id", server.revokeSession)
+	authRoutes.POST("/me/api-keys", server.createAPIKey)
+	authRoutes.GET("/me/api-keys", server.listAPIKeys)
+	authRoutes.DELETE("/me/api-keys/:id", server.revokeAPIKey)
+
+	//routes below also accept an API key with the scope they ask for, for bots and scripts
+	keyRoutes := router.Group("/", server.authOrAPIKeyMiddleware())
+	keyRoutes.POST("/post", requireScope(ScopePostsWrite), server.createPost)
+	keyRoutes.GET("/post/:id", requireScope(ScopePostsRead), server.getPost)
+	keyRoutes.GET("/post", requireScope(ScopePostsRead), server.listPosts)
+	keyRoutes.GET("/posts/search", requireScope(ScopePostsRead), server.searchPosts)
+	keyRoutes.PUT("/posts", requireScope(ScopePostsWrite), server.updatePost)
+	keyRoutes.DELETE("/posts/:id", requireScope(ScopePostsWrite), server.deletePost)
+	keyRoutes.POST("/posts/:id/comments", requireScope(ScopePostsWrite), server.createComment)
+	keyRoutes.GET("/posts/:id/comments", requireScope(ScopePostsRead), server.listComments)
+	keyRoutes.PUT("/posts/:id/reactions/:reaction", requireScope(ScopePostsWrite), server.addReaction)
+	keyRoutes.DELETE("/posts/:id/reactions/:reaction", requireScope(ScopePostsWrite), server.removeReaction)
+	keyRoutes.PATCH("/comments/:id", requireScope(ScopePostsWrite), server.updateComment)
+	keyRoutes.DELETE("/comments/:id", requireScope(ScopePostsWrite), server.deleteComment)
+
+	//moderation and user management, each route declares the roles allowed to use it
+	authRoutes.DELETE("/admin/posts/:id", requireRole(RoleModerator, RoleAdmin), server.deleteAnyPost)
+	authRoutes.DELETE("/admin/comments/:id", requireRole(RoleModerator, RoleAdmin), server.deleteAnyComment)
+	authRoutes.GET("/admin/users", requireRole(RoleAdmin), server.listUsers)
+	authRoutes.PATCH("/admin/users/:id/role", requireRole(RoleAdmin), server.updateUserRole)
+	authRoutes.DELETE("/admin/users/:id", requireRole(RoleAdmin), server.deleteUser)
+	authRoutes.POST("/admin/users/:id/unlock", requireRole(RoleAdmin), server.unlockUser)
 
 	return router
 }
@@ -77,7 +245,9 @@ func (server *Server) WireHttpHandler() http.Handler {
 type signupRequest struct {
 	Username string `json:"username" binding:"required,alphanum"` // Must be present, must only contain letters/numbers.
 	Email    string `json:"email" binding:"required,email"`       // Must be present, must be a valid email format.
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"`          // Checked against the password policy by the handler.
+	// InviteCode is only needed when the email domain is not in the allowlist.
+	InviteCode string `json:"invite_code"`
 }
 
 func (server *Server) signup(c *gin.Context) {
@@ -88,8 +258,24 @@ func (server *Server) signup(c *gin.Context) {
 		return
 	}
 
+	req.Email = normalizeEmail(req.Email)
+	if !server.acceptablePassword(c, req.Password, req.Username, req.Email) {
+		return
+	}
+
+	//step 1: only company emails or invited people can sign up
+	invitation, err := server.signupInvitation(c, req.Email, req.InviteCode)
+	if err != nil {
+		if errors.Is(err, ErrSignupNotAllowed) || errors.Is(err, ErrInvalidInvitation) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
 	//step2 hash the password securely
-	hashedPassword, err := HashedPassword(req.Password)
+	hashedPassword, err := server.PasswordHasher.Hash(req.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error:": "failed to hash password, username or email already taken"})
 		return
@@ -100,26 +286,60 @@ func (server *Server) signup(c *gin.Context) {
 		Email:          req.Email,
 		HashedPassword: hashedPassword,
 	}
+	if invitation != nil {
+		arg.InvitedBy = &invitation.CreatedBy
+	}
 
-	//create the user using the generated go function (**important)
-	_, err = server.store.CreateUser(c, arg)
+	//create the user using the generated go function (**important).
+	// the invitation is consumed in the same transaction, if someone else took its last use meanwhile
+	// the account is never created
+	var user repo.User
+	err = server.inTx(c, func(q *repo.Queries) error {
+		var err error
+		user, err = q.CreateUser(c, arg)
+		if err != nil || invitation == nil {
+			return err
+		}
+		rows, err := q.UseInvitation(c, invitation.ID)
+		if err == nil && rows == 0 {
+			err = ErrInvalidInvitation
+		}
+		return err
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// usernames and emails are unique without regard to case
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "username or email already taken"})
+			return
+		}
+		if errors.Is(err, ErrInvalidInvitation) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
+
+	//step 4: send the verification link, the account exists even if the mail fails and can ask for a resend
+	if err := server.sendVerificationEmail(c, user); err != nil {
+		_ = c.Error(err)
+	}
 	c.JSON(http.StatusCreated, gin.H{"message": "User crested successfully"})
 
 }
 
 // login
 type loginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	// Identifier is the username or the email, Email is still accepted from older clients.
+	Identifier string `json:"identifier" binding:"required_without=Email"`
+	Email      string `json:"email" binding:"omitempty,email"`
+	Password   string `json:"password" binding:"required"`
 }
 
 type loginResponse struct {
-	AccessToken string `json:"access_token"`
-	Username    string `json:"username"`
+	tokenPair
+	Username      string `json:"username"`
+	EmailVerified bool   `json:"email_verified"`
 }
 
 func (server *Server) login(c *gin.Context) {
@@ -130,46 +350,138 @@ func (server *Server) login(c *gin.Context) {
 		return
 	}
 
-	//step 2 retrieve the user
-	user, err := server.store.GetUseryByEmail(c, req.Email)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
-			return
-		}
+	//step 2 retrieve the user, by email when the identifier has an @ (usernames cannot)
+	identifier := strings.TrimSpace(req.Identifier)
+	if identifier == "" {
+		identifier = req.Email
+	}
+	user, err := server.userByLoginIdentifier(c, identifier)
+	found := err == nil
+	if err != nil && err != pgx.ErrNoRows {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
 
-	//step 3 verify password
+	//step 3 slow down repeated failures, per account and per client IP.
+	// the account is keyed by its email whatever identifier was used, unknown ones by the identifier itself
+	throttleKey := identifier
+	if found {
+		throttleKey = user.Email
+	}
+	if !server.checkLoginThrottle(c, throttleKey) {
+		return
+	}
+
+	if !found {
+		// same work and same answer as a wrong password, so unknown accounts cannot be told apart
+		_ = CheckPassword(req.Password, server.dummyPasswordHash())
+		server.loginFailed(c, throttleKey)
+		return
+	}
+
+	//step 4 verify password
 	err = CheckPassword(req.Password, user.HashedPassword)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		server.loginFailed(c, throttleKey)
+		return
+	}
+	server.rehashPassword(c, user, req.Password)
+
+	if server.emailVerificationRequired(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrEmailNotVerified.Error()})
+		return
+	}
+
+	//step 5 when two-factor authentication is on, the password alone only earns a challenge.
+	// the failures are kept until the second factor is right too, so they keep adding up across challenges
+	mfaEnabled, err := server.totpEnabled(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if mfaEnabled {
+		server.startLoginChallenge(c, user)
 		return
 	}
 
-	//step 4 generate the jwt token
-	tokenDuration := 24 * time.Hour
-	token, err := GenerateToken(user.ID, user.Username, server.JWTSecret, tokenDuration)
+	//step 6 issue the tokens and send the response
+	server.loginSucceeded(c, throttleKey)
+	server.completeLogin(c, user)
+}
+
+// completeLogin starts a new login session for the user and sends the login response.
+func (server *Server) completeLogin(c *gin.Context, user repo.User) {
+	familyID, err := server.startLoginSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+	tokens, err := server.issueTokens(c, server.store, user, familyID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
 		return
 	}
 
-	//step 5 send the response
 	rsp := loginResponse{
-		AccessToken: token,
-		Username:    user.Username,
+		tokenPair:     tokens,
+		Username:      user.Username,
+		EmailVerified: user.VerifiedAt.Valid,
 	}
 	c.JSON(http.StatusOK, rsp)
+}
 
+// postResponse is a post as listed and read, with its tags and reactions.
+type postResponse struct {
+	repo.Post
+	Tags      []string        `json:"tags"`
+	Reactions []reactionCount `json:"reactions"`
+}
+
+// postResponses adds the tags and reaction counts to the posts, with a single query for each.
+func (server *Server) postResponses(c *gin.Context, posts []repo.Post) ([]postResponse, error) {
+	ids := make([]int32, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	tags, err := server.postTags(c, ids)
+	if err != nil {
+		return nil, err
+	}
+	reactions, err := server.reactionCounts(c, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp := make([]postResponse, 0, len(posts))
+	for _, post := range posts {
+		postTags := tags[post.ID]
+		if postTags == nil {
+			postTags = make([]string, 0)
+		}
+		counts := reactions[post.ID]
+		if counts == nil {
+			counts = make([]reactionCount, 0)
+		}
+		rsp = append(rsp, postResponse{Post: post, Tags: postTags, Reactions: counts})
+	}
+	return rsp, nil
+}
+
+// sendPost answers with the post as getPost shows it.
+func (server *Server) sendPost(c *gin.Context, status int, post repo.Post) {
+	rsp, err := server.postResponses(c, []repo.Post{post})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve post"})
+		return
+	}
+	c.JSON(status, rsp[0])
 }
 
 // POST
 type createPostRequest struct {
-	Title   string `json:"title" binding:"required"`
-	Content string `json:"content" binding:"required"`
-	UserID  int32  `json:"user_id" binding:"required"`
+	Title   string   `json:"title" binding:"required"`
+	Content string   `json:"content" binding:"required"`
+	Tags    []string `json:"tags"`
 }
 
 func (server *Server) createPost(c *gin.Context) {
@@ -179,35 +491,143 @@ func (server *Server) createPost(c *gin.Context) {
 		return
 	}
 
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the author is always the authenticated caller, never taken from the body
+	claims := authClaims(c)
 	arg := repo.CreatePostParams{
 		Title:   req.Title,
 		Content: req.Content,
-		UserID:  req.UserID,
+		UserID:  claims.ID,
 	}
 
-	post, err := server.store.CreatePost(c, arg)
+	var post repo.Post
+	err = server.inTx(c, func(q *repo.Queries) error {
+		var err error
+		post, err = q.CreatePost(c, arg)
+		if err != nil || len(tags) == 0 {
+			return err
+		}
+		return q.AddPostTags(c, repo.AddPostTagsParams{PostID: post.ID, Tags: tags})
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create post"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, post)
+	server.sendPost(c, http.StatusCreated, post)
 }
 
-// get all post
+// get all post, newest first unless asked otherwise. Pages are read with the cursor of the
+// previous page, page_id still works the old way until clients have moved over.
+const defaultPostPageSize = 10
+
 type listPostsRequest struct {
-	PageID   int32 `form:"page_id" binding:"required,min=1"`
-	PageSize int32 `form:"page_size" binding:"required,min=5,max=20"`
+	AuthorID int32     `form:"author_id" binding:"omitempty,min=1"`
+	Tag      string    `form:"tag"`
+	From     time.Time `form:"from" time_format:"2006-01-02" time_utc:"1"`
+	To       time.Time `form:"to" time_format:"2006-01-02" time_utc:"1"` // inclusive
+	Sort     string    `form:"sort" binding:"omitempty,oneof=newest oldest most_commented most_reacted"`
+	Cursor   string    `form:"cursor"`
+	PageSize int32     `form:"page_size" binding:"omitempty,min=5,max=20"`
+	// Deprecated: offset paging skips and repeats posts created while paging, use cursor.
+	// It predates the filters and cannot be combined with them.
+	PageID int32 `form:"page_id" binding:"omitempty,min=1,excluded_with=Cursor AuthorID Tag From To Sort"`
+}
+
+type listPostsResponse struct {
+	Posts      []postResponse `json:"posts"`
+	NextCursor string         `json:"next_cursor,omitempty"` // left out on the last page
 }
 
 func (server *Server) listPosts(c *gin.Context) {
 	var req listPostsRequest
-	// We use ShouldBindQuery for ?page_id=1&page_size=10
+	// We use ShouldBindQuery for ?sort=oldest&cursor=...&page_size=10
 	if err := c.ShouldBindQuery(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !req.From.IsZero() && !req.To.IsZero() && req.To.Before(req.From) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return
+	}
+	if req.PageSize == 0 {
+		req.PageSize = defaultPostPageSize
+	}
+
+	if req.PageID > 0 {
+		server.listPostsByPage(c, req)
+		return
+	}
 
+	// one extra row tells whether there is a next page
+	arg := postquery.Params{
+		Sort:  postquery.SortNewest,
+		Limit: req.PageSize + 1,
+	}
+	if req.Sort != "" {
+		arg.Sort = postquery.Sort(req.Sort)
+	}
+	if req.AuthorID > 0 {
+		arg.AuthorID = &req.AuthorID
+	}
+	if req.Tag != "" {
+		tag, err := normalizeTag(req.Tag)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		arg.Tag = &tag
+	}
+	if !req.From.IsZero() {
+		arg.CreatedFrom = pgtype.Timestamptz{Time: req.From, Valid: true}
+	}
+	if !req.To.IsZero() {
+		arg.CreatedTo = pgtype.Timestamptz{Time: req.To.AddDate(0, 0, 1), Valid: true}
+	}
+	if req.Cursor != "" {
+		cursor, err := decodePostCursor(req.Cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if cursor.Sort != arg.Sort {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor was issued for another sort order"})
+			return
+		}
+		arg.After = &cursor.Key
+	}
+
+	rows, err := server.listPostsFiltered(c, arg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve posts"})
+		return
+	}
+
+	var rsp listPostsResponse
+	if len(rows) > int(req.PageSize) {
+		rows = rows[:req.PageSize]
+		rsp.NextCursor = postCursor{Sort: arg.Sort, Key: rows[len(rows)-1].Key()}.encode()
+	}
+
+	posts := make([]repo.Post, 0, len(rows))
+	for _, row := range rows {
+		posts = append(posts, row.Post)
+	}
+	rsp.Posts, err = server.postResponses(c, posts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve posts"})
+		return
+	}
+	c.JSON(http.StatusOK, rsp)
+}
+
+// listPostsByPage answers page_id requests with the old bare array.
+func (server *Server) listPostsByPage(c *gin.Context, req listPostsRequest) {
 	// Calculate OFFSET for SQL (e.g., Page 2 with size 10 starts at record 10)
 	arg := repo.ListPostsParams{
 		Limit:  req.PageSize,
@@ -220,7 +640,14 @@ func (server *Server) listPosts(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, posts)
+	rsp, err := server.postResponses(c, posts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve posts"})
+		return
+	}
+
+	c.Header("Deprecation", "true")
+	c.JSON(http.StatusOK, rsp)
 }
 
 // get post by id
@@ -246,14 +673,15 @@ func (server *Server) getPost(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, post)
+	server.sendPost(c, http.StatusOK, post)
 }
 
-// update post
+// update post. Tags replace the post's tags when given, an empty list removes them all.
 type updatePostRequest struct {
-	ID      int32  `json:"id" binding:"required,min=1"`
-	Title   string `json:"title" binding:"required"`
-	Content string `json:"content" binding:"required"`
+	ID      int32    `json:"id" binding:"required,min=1"`
+	Title   string   `json:"title" binding:"required"`
+	Content string   `json:"content" binding:"required"`
+	Tags    []string `json:"tags"`
 }
 
 func (server *Server) updatePost(c *gin.Context) {
@@ -264,19 +692,43 @@ func (server *Server) updatePost(c *gin.Context) {
 		return
 	}
 
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// only the author can update the post, anyone else gets a not found
+	claims := authClaims(c)
 	arg := repo.UpdatePostParams{
 		ID:      req.ID,
+		UserID:  claims.ID,
 		Title:   req.Title,
 		Content: req.Content,
 	}
 
-	post, err := server.store.UpdatePost(c, arg)
+	var post repo.Post
+	err = server.inTx(c, func(q *repo.Queries) error {
+		var err error
+		post, err = q.UpdatePost(c, arg)
+		if err != nil || tags == nil {
+			return err
+		}
+		if err := q.DeletePostTags(c, post.ID); err != nil {
+			return err
+		}
+		return q.AddPostTags(c, repo.AddPostTagsParams{PostID: post.ID, Tags: tags})
+	})
 	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update post"})
 		return
 	}
 
-	c.JSON(http.StatusOK, post)
+	server.sendPost(c, http.StatusOK, post)
 }
 
 // delete
@@ -291,11 +743,21 @@ func (server *Server) deletePost(c *gin.Context) {
 		return
 	}
 
-	err := server.store.DeletePost(c, req.ID)
+	claims := authClaims(c)
+	arg := repo.DeletePostParams{
+		ID:     req.ID,
+		UserID: claims.ID,
+	}
+
+	rows, err := server.store.DeletePost(c, arg)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete post"})
 		return
 	}
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
 }
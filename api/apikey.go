@@ -0,0 +1,240 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+// API keys look like "ikc_<prefix>_<secret>". The prefix is stored as is to find the key,
+// only a hash of the secret is stored.
+const (
+	apiKeyHeaderKey   = "X-API-Key"
+	apiKeyPayloadKey  = "api_key_payload"
+	apiKeyTag         = "ikc_"
+	apiKeyPrefixBytes = 6
+	maxAPIKeysPerUser = 20
+)
+
+// The scopes an API key can be given, a key can only reach the routes that ask for one of its scopes.
+const (
+	ScopePostsRead  = "posts:read"
+	ScopePostsWrite = "posts:write"
+)
+
+var ErrInvalidAPIKey = errors.New("api key is invalid")
+
+// newAPIKey returns the full key handed to the user once, and the prefix and secret hash we store.
+func newAPIKey() (key string, prefix string, secretHash string, err error) {
+	b := make([]byte, apiKeyPrefixBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	prefix = hex.EncodeToString(b)
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+	return apiKeyTag + prefix + "_" + secret, prefix, hashToken(secret), nil
+}
+
+// parseAPIKey splits a key into its prefix and secret, the prefix is hex so the first "_" ends it.
+func parseAPIKey(key string) (prefix string, secret string, ok bool) {
+	rest, found := strings.CutPrefix(key, apiKeyTag)
+	if !found {
+		return "", "", false
+	}
+	prefix, secret, found = strings.Cut(rest, "_")
+	if !found || len(prefix) != 2*apiKeyPrefixBytes || secret == "" {
+		return "", "", false
+	}
+	return prefix, secret, true
+}
+
+// authenticateAPIKey returns the key and its owner, ErrInvalidAPIKey for unknown, revoked or expired keys.
+func (server *Server) authenticateAPIKey(c *gin.Context, key string) (repo.APIKey, repo.User, error) {
+	prefix, secret, ok := parseAPIKey(key)
+	if !ok {
+		return repo.APIKey{}, repo.User{}, ErrInvalidAPIKey
+	}
+
+	apiKey, err := server.store.GetAPIKeyByPrefix(c, prefix)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return repo.APIKey{}, repo.User{}, ErrInvalidAPIKey
+		}
+		return repo.APIKey{}, repo.User{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(apiKey.SecretHash)) != 1 {
+		return repo.APIKey{}, repo.User{}, ErrInvalidAPIKey
+	}
+	if apiKey.RevokedAt.Valid || (apiKey.ExpiresAt.Valid && time.Now().After(apiKey.ExpiresAt.Time)) {
+		return repo.APIKey{}, repo.User{}, ErrInvalidAPIKey
+	}
+
+	// the role is read on every request so a demotion applies to keys right away
+	user, err := server.store.GetUser(c, apiKey.UserID)
+	if err != nil {
+		return repo.APIKey{}, repo.User{}, err
+	}
+
+	if err := server.store.TouchAPIKey(c, apiKey.ID); err != nil {
+		_ = c.Error(err)
+	}
+	return apiKey, user, nil
+}
+
+// requireScope lets API keys through only when they have the scope, access tokens always pass.
+// It must run after authOrAPIKeyMiddleware.
+func requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get(apiKeyPayloadKey)
+		if !ok || slices.Contains(value.(repo.APIKey).Scopes, scope) {
+			c.Next()
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "api key is missing the " + scope + " scope"})
+	}
+}
+
+// create an API key for the caller
+type createAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1,dive,oneof=posts:read posts:write"`
+	ExpiresInDays int32    `json:"expires_in_days" binding:"omitempty,min=1,max=365"` // never expires when left out
+}
+
+type apiKeyResponse struct {
+	ID         int32      `json:"id"`
+	Name       string     `json:"name"`
+	Key        string     `json:"key,omitempty"` // only returned once, when the key is created
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newAPIKeyResponse(apiKey repo.APIKey) apiKeyResponse {
+	return apiKeyResponse{
+		ID:         apiKey.ID,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     apiKey.Scopes,
+		ExpiresAt:  timestampPtr(apiKey.ExpiresAt),
+		LastUsedAt: timestampPtr(apiKey.LastUsedAt),
+		RevokedAt:  timestampPtr(apiKey.RevokedAt),
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
+
+// timestampPtr turns a nullable timestamp into something that marshals to null.
+func timestampPtr(ts pgtype.Timestamptz) *time.Time {
+	if !ts.Valid {
+		return nil
+	}
+	return &ts.Time
+}
+
+func (server *Server) createAPIKey(c *gin.Context) {
+	var req createAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := authClaims(c).ID
+	count, err := server.store.CountActiveAPIKeys(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if count >= maxAPIKeysPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": "too many active api keys, revoke one first"})
+		return
+	}
+
+	key, prefix, secretHash, err := newAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate api key"})
+		return
+	}
+
+	arg := repo.CreateAPIKeyParams{
+		UserID:     userID,
+		Name:       req.Name,
+		Prefix:     prefix,
+		SecretHash: secretHash,
+		Scopes:     slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+	}
+	if req.ExpiresInDays > 0 {
+		arg.ExpiresAt = pgtype.Timestamptz{Time: time.Now().AddDate(0, 0, int(req.ExpiresInDays)), Valid: true}
+	}
+
+	apiKey, err := server.store.CreateAPIKey(c, arg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create api key"})
+		return
+	}
+
+	rsp := newAPIKeyResponse(apiKey)
+	rsp.Key = key
+	c.JSON(http.StatusCreated, rsp)
+}
+
+// list the caller's API keys, revoked ones included
+func (server *Server) listAPIKeys(c *gin.Context) {
+	apiKeys, err := server.store.ListAPIKeysByUser(c, authClaims(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve api keys"})
+		return
+	}
+
+	rsp := make([]apiKeyResponse, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		rsp = append(rsp, newAPIKeyResponse(apiKey))
+	}
+	c.JSON(http.StatusOK, rsp)
+}
+
+// revoke one of the caller's API keys
+type apiKeyIDRequest struct {
+	ID int32 `uri:"id" binding:"required,min=1"`
+}
+
+func (server *Server) revokeAPIKey(c *gin.Context) {
+	var uri apiKeyIDRequest
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := server.store.RevokeAPIKey(c, repo.RevokeAPIKeyParams{
+		ID:     uri.ID,
+		UserID: authClaims(c).ID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke api key"})
+		return
+	}
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	db.returns("CountActiveAPIKeys", int64(0), nil)
+	db.on("CreateAPIKey", func(args ...interface{}) (interface{}, error) {
+		return repo.APIKey{
+			ID:         1,
+			UserID:     args[0].(int32),
+			Name:       args[1].(string),
+			Prefix:     args[2].(string),
+			SecretHash: args[3].(string),
+			Scopes:     args[4].([]string),
+			ExpiresAt:  args[5].(pgtype.Timestamptz),
+			CreatedAt:  time.Now(),
+		}, nil
+	})
+	token := accessToken(t, server, testUser, "family")
+
+	rec := serve(server, http.MethodPost, "/me/api-keys", `{"name": "ci", "scopes": ["posts:write", "posts:read", "posts:write"], "expires_in_days": 30}`, token)
+	expectStatus(t, rec, http.StatusCreated)
+
+	var rsp apiKeyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &rsp); err != nil {
+		t.Fatal(err)
+	}
+	prefix, secret, ok := parseAPIKey(rsp.Key)
+	if !ok {
+		t.Fatalf("key = %q, not an API key", rsp.Key)
+	}
+	created := db.called("CreateAPIKey")
+	if len(created) != 1 || created[0][0] != testUser.ID || created[0][2] != prefix || created[0][3] != hashToken(secret) {
+		t.Fatalf("CreateAPIKey calls = %v, want the prefix and the hash of the secret", created)
+	}
+	if strings.Join(rsp.Scopes, " ") != "posts:read posts:write" {
+		t.Errorf("scopes = %v, want sorted without duplicates", rsp.Scopes)
+	}
+	if rsp.ExpiresAt == nil || rsp.ExpiresAt.Before(time.Now().AddDate(0, 0, 29)) {
+		t.Errorf("expires at %v, want in 30 days", rsp.ExpiresAt)
+	}
+	if strings.Contains(rec.Body.String(), "secret_hash") {
+		t.Errorf("the response shows the hash: %s", rec.Body.String())
+	}
+}
+
+func TestCreateAPIKeyRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		active int64
+		want   int
+	}{
+		{name: "unknown scope", body: `{"name": "ci", "scopes": ["admin"]}`, want: http.StatusBadRequest},
+		{name: "no scope", body: `{"name": "ci", "scopes": []}`, want: http.StatusBadRequest},
+		{name: "no name", body: `{"scopes": ["posts:read"]}`, want: http.StatusBadRequest},
+		{name: "never expiring past a year", body: `{"name": "ci", "scopes": ["posts:read"], "expires_in_days": 366}`, want: http.StatusBadRequest},
+		{name: "too many keys", body: `{"name": "ci", "scopes": ["posts:read"]}`, active: maxAPIKeysPerUser, want: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, db := newTestServer(t)
+			newFakeRevocations(db)
+			db.returns("CountActiveAPIKeys", tt.active, nil)
+
+			expectStatus(t, serve(server, http.MethodPost, "/me/api-keys", tt.body, accessToken(t, server, testUser, "family")), tt.want)
+			if len(db.called("CreateAPIKey")) != 0 {
+				t.Error("a key was created")
+			}
+		})
+	}
+}
+
+func TestListAPIKeys(t *testing.T) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	db.returns("ListAPIKeysByUser", []repo.APIKey{
+		{ID: 2, UserID: testUser.ID, Name: "ci", Prefix: "abcdef012345", SecretHash: "api-key-hash-value", Scopes: []string{ScopePostsRead}, CreatedAt: time.Now()},
+		{ID: 1, UserID: testUser.ID, Name: "old", Prefix: "012345abcdef", SecretHash: "old-key-hash-value", Scopes: []string{ScopePostsWrite}, RevokedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true}, CreatedAt: time.Now()},
+	}, nil)
+
+	rec := serve(server, http.MethodGet, "/me/api-keys", "", accessToken(t, server, testUser, "family"))
+	expectStatus(t, rec, http.StatusOK)
+	if strings.Contains(rec.Body.String(), "hash-value") {
+		t.Errorf("the response shows a hash: %s", rec.Body.String())
+	}
+
+	var rsp []apiKeyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &rsp); err != nil {
+		t.Fatal(err)
+	}
+	if len(rsp) != 2 || rsp[0].Key != "" || rsp[0].RevokedAt != nil || rsp[1].RevokedAt == nil {
+		t.Errorf("api keys = %+v, want both, the revoked one included", rsp)
+	}
+	if calls := db.called("ListAPIKeysByUser"); len(calls) != 1 || calls[0][0] != testUser.ID {
+		t.Errorf("ListAPIKeysByUser calls = %v", calls)
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	db.on("RevokeAPIKey", func(args ...interface{}) (interface{}, error) {
+		if args[0].(int32) != 1 || args[1].(int32) != testUser.ID {
+			return int64(0), nil
+		}
+		return int64(1), nil
+	})
+	token := accessToken(t, server, testUser, "family")
+
+	expectStatus(t, serve(server, http.MethodDelete, "/me/api-keys/1", "", token), http.StatusOK)
+	// someone else's key looks like a missing one
+	expectStatus(t, serve(server, http.MethodDelete, "/me/api-keys/2", "", token), http.StatusNotFound)
+	expectStatus(t, serve(server, http.MethodDelete, "/me/api-keys/0", "", token), http.StatusBadRequest)
+}
+
+// newAPIKeyServer returns a server knowing one API key of testUser with the given scopes,
+// and the key itself.
+func newAPIKeyServer(t *testing.T, scopes ...string) (*Server, *fakeDB, string) {
+	server, db, _ := newPostServer(t)
+	key, prefix, secretHash, err := newAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.on("GetAPIKeyByPrefix", func(args ...interface{}) (interface{}, error) {
+		if args[0] != prefix {
+			return nil, pgx.ErrNoRows
+		}
+		return repo.APIKey{ID: 1, UserID: testUser.ID, Name: "ci", Prefix: prefix, SecretHash: secretHash, Scopes: scopes}, nil
+	})
+	db.returns("TouchAPIKey", nil, nil)
+	db.returns("GetPost", repo.Post{ID: 1, Title: "Hello", Content: "World", UserID: testUser.ID}, nil)
+	db.returns("CreatePost", repo.Post{ID: 2, Title: "Hello", Content: "World", UserID: testUser.ID}, nil)
+	return server, db, key
+}
+
+func serveWithAPIKey(server *Server, method string, target string, body string, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(apiKeyHeaderKey, key)
+	return serveRequest(server, req)
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	server, db, key := newAPIKeyServer(t, ScopePostsRead)
+	prefix, _, _ := parseAPIKey(key)
+
+	expectStatus(t, serveWithAPIKey(server, http.MethodGet, "/post/1", "", key), http.StatusOK)
+	if touched := db.called("TouchAPIKey"); len(touched) != 1 || touched[0][0] != int32(1) {
+		t.Errorf("TouchAPIKey calls = %v, want the last use recorded", touched)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{name: "wrong secret", key: apiKeyTag + prefix + "_wrong"},
+		{name: "unknown prefix", key: apiKeyTag + "000000000000_" + strings.Repeat("a", 43)},
+		{name: "no tag", key: strings.TrimPrefix(key, apiKeyTag)},
+		{name: "short prefix", key: apiKeyTag + "abc_secret"},
+		{name: "no secret", key: apiKeyTag + prefix + "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, serveWithAPIKey(server, http.MethodGet, "/post/1", "", tt.key), http.StatusUnauthorized)
+		})
+	}
+
+	// keys only reach the post routes, not the account
+	expectStatus(t, serveWithAPIKey(server, http.MethodGet, "/me", "", key), http.StatusUnauthorized)
+	expectStatus(t, serveWithAPIKey(server, http.MethodPost, "/me/api-keys", `{"name": "more", "scopes": ["posts:write"]}`, key), http.StatusUnauthorized)
+}
+
+func TestAPIKeyRefusedWhenRevokedOrExpired(t *testing.T) {
+	ended := pgtype.Timestamptz{Time: time.Now().Add(-time.Minute), Valid: true}
+	tests := []struct {
+		name                 string
+		revokedAt, expiresAt pgtype.Timestamptz
+	}{
+		{name: "revoked", revokedAt: ended},
+		{name: "expired", expiresAt: ended},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, db := newTestServer(t)
+			key, prefix, secretHash, err := newAPIKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			apiKey := repo.APIKey{ID: 1, UserID: testUser.ID, Prefix: prefix, SecretHash: secretHash, Scopes: []string{ScopePostsRead}, RevokedAt: tt.revokedAt, ExpiresAt: tt.expiresAt}
+			db.returns("GetAPIKeyByPrefix", apiKey, nil)
+
+			expectStatus(t, serveWithAPIKey(server, http.MethodGet, "/post/1", "", key), http.StatusUnauthorized)
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	t.Run("read-only key", func(t *testing.T) {
+		server, db, key := newAPIKeyServer(t, ScopePostsRead)
+
+		expectStatus(t, serveWithAPIKey(server, http.MethodGet, "/post/1", "", key), http.StatusOK)
+		expectStatus(t, serveWithAPIKey(server, http.MethodPost, "/post", `{"title": "Hello", "content": "World"}`, key), http.StatusForbidden)
+		expectStatus(t, serveWithAPIKey(server, http.MethodDelete, "/posts/1", "", key), http.StatusForbidden)
+		if len(db.called("CreatePost")) != 0 {
+			t.Error("a post was created without the write scope")
+		}
+	})
+
+	t.Run("write-only key", func(t *testing.T) {
+		server, db, key := newAPIKeyServer(t, ScopePostsWrite)
+
+		expectStatus(t, serveWithAPIKey(server, http.MethodPost, "/post", `{"title": "Hello", "content": "World"}`, key), http.StatusCreated)
+		expectStatus(t, serveWithAPIKey(server, http.MethodGet, "/post/1", "", key), http.StatusForbidden)
+		if created := db.called("CreatePost"); len(created) != 1 || created[0][2] != testUser.ID {
+			t.Errorf("CreatePost calls = %v, want the key's owner as author", created)
+		}
+	})
+
+	t.Run("access token", func(t *testing.T) {
+		server, _, _ := newAPIKeyServer(t)
+		token := accessToken(t, server, testUser, "family")
+
+		// scopes only restrict API keys
+		expectStatus(t, serve(server, http.MethodGet, "/post/1", "", token), http.StatusOK)
+		expectStatus(t, serve(server, http.MethodPost, "/post", `{"title": "Hello", "content": "World"}`, token), http.StatusCreated)
+	})
+}
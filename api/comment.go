@@ -0,0 +1,209 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+// The formats a post's comments can be listed in.
+const (
+	CommentFormatTree = "tree"
+	CommentFormatFlat = "flat"
+)
+
+// postIDRequest is the post in /posts/:id/comments
+type postIDRequest struct {
+	ID int32 `uri:"id" binding:"required,min=1"`
+}
+
+// comment on a post, or reply to one of its comments
+type createCommentRequest struct {
+	Content         string `json:"content" binding:"required,max=10000"`
+	ParentCommentID *int32 `json:"parent_comment_id" binding:"omitempty,min=1"`
+}
+
+func (server *Server) createComment(c *gin.Context) {
+	var uri postIDRequest
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var req createCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !server.postExists(c, uri.ID) {
+		return
+	}
+
+	comment, err := server.store.CreateComment(c, repo.CreateCommentParams{
+		PostID:          uri.ID,
+		UserID:          authClaims(c).ID,
+		ParentCommentID: req.ParentCommentID,
+		Content:         req.Content,
+	})
+	if err != nil {
+		// the parent key also covers the post, a reply to a comment of another post fails here
+		if isForeignKeyViolation(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "parent comment not found on this post"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create comment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// list a post's comments, as a tree of replies or flattened in thread order with their depth
+type listCommentsRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=tree flat"`
+}
+
+// commentNode is a comment with its replies, oldest first.
+type commentNode struct {
+	repo.Comment
+	Replies []*commentNode `json:"replies"`
+}
+
+func (server *Server) listComments(c *gin.Context) {
+	var uri postIDRequest
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var req listCommentsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !server.postExists(c, uri.ID) {
+		return
+	}
+
+	comments, err := server.store.ListCommentsByPost(c, uri.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve comments"})
+		return
+	}
+
+	if req.Format == CommentFormatFlat {
+		c.JSON(http.StatusOK, comments)
+		return
+	}
+	c.JSON(http.StatusOK, commentTree(comments))
+}
+
+// commentTree nests the comments under their parents. It relies on the thread order of
+// ListCommentsByPost, where a parent always comes before its replies.
+func commentTree(comments []repo.ListCommentsByPostRow) []*commentNode {
+	roots := make([]*commentNode, 0)
+	nodes := make(map[int32]*commentNode, len(comments))
+	for _, row := range comments {
+		node := &commentNode{
+			Comment: repo.Comment{
+				ID:              row.ID,
+				PostID:          row.PostID,
+				UserID:          row.UserID,
+				ParentCommentID: row.ParentCommentID,
+				Content:         row.Content,
+				CreatedAt:       row.CreatedAt,
+				UpdatedAt:       row.UpdatedAt,
+			},
+			Replies: make([]*commentNode, 0),
+		}
+		nodes[row.ID] = node
+
+		if row.ParentCommentID == nil {
+			roots = append(roots, node)
+			continue
+		}
+		parent := nodes[*row.ParentCommentID]
+		parent.Replies = append(parent.Replies, node)
+	}
+	return roots
+}
+
+// edit a comment, only its author can
+type commentIDRequest struct {
+	ID int32 `uri:"id" binding:"required,min=1"`
+}
+
+type updateCommentRequest struct {
+	Content string `json:"content" binding:"required,max=10000"`
+}
+
+func (server *Server) updateComment(c *gin.Context) {
+	var uri commentIDRequest
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var req updateCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// only the author can update the comment, anyone else gets a not found
+	comment, err := server.store.UpdateComment(c, repo.UpdateCommentParams{
+		ID:      uri.ID,
+		UserID:  authClaims(c).ID,
+		Content: req.Content,
+	})
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update comment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, comment)
+}
+
+// delete a comment and the replies under it, only its author can
+func (server *Server) deleteComment(c *gin.Context) {
+	var uri commentIDRequest
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := server.store.DeleteComment(c, repo.DeleteCommentParams{
+		ID:     uri.ID,
+		UserID: authClaims(c).ID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete comment"})
+		return
+	}
+	if rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
+}
+
+// postExists answers 404 itself when the post is not there.
+func (server *Server) postExists(c *gin.Context, postID int32) bool {
+	_, err := server.store.GetPost(c, postID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+func commentRow(id int32, parent int32, depth int32) repo.ListCommentsByPostRow {
+	row := repo.ListCommentsByPostRow{ID: id, PostID: 1, UserID: testUser.ID, Content: "comment", Depth: depth}
+	if parent != 0 {
+		row.ParentCommentID = &parent
+	}
+	return row
+}
+
+// shape writes the tree as ids with the replies in parentheses, 1(2(3)4)5.
+func shape(nodes []*commentNode) string {
+	var s string
+	for _, node := range nodes {
+		s += string(rune('0' + node.ID))
+		if len(node.Replies) > 0 {
+			s += "(" + shape(node.Replies) + ")"
+		}
+	}
+	return s
+}
+
+func TestCommentTree(t *testing.T) {
+	// the thread order of ListCommentsByPost: every reply follows its parent
+	rows := []repo.ListCommentsByPostRow{
+		commentRow(1, 0, 0),
+		commentRow(2, 1, 1),
+		commentRow(3, 2, 2),
+		commentRow(4, 1, 1),
+		commentRow(5, 0, 0),
+		commentRow(6, 5, 1),
+	}
+
+	tree := commentTree(rows)
+	if got := shape(tree); got != "1(2(3)4)5(6)" {
+		t.Fatalf("tree = %s, want 1(2(3)4)5(6)", got)
+	}
+}
+
+func TestCommentTreeJSON(t *testing.T) {
+	body, err := json.Marshal(commentTree([]repo.ListCommentsByPostRow{commentRow(1, 0, 0)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodes []map[string]json.RawMessage
+	if err := json.Unmarshal(body, &nodes); err != nil {
+		t.Fatal(err)
+	}
+	// leaves have an empty list of replies rather than null, and the comment fields are inlined
+	if string(nodes[0]["replies"]) != "[]" || string(nodes[0]["id"]) != "1" {
+		t.Errorf("json = %s", body)
+	}
+
+	if body, _ := json.Marshal(commentTree(nil)); string(body) != "[]" {
+		t.Errorf("no comments: json = %s, want []", body)
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/postquery"
+)
+
+var ErrInvalidCursor = errors.New("cursor is invalid")
+
+// postCursor is the position of the last post of a feed page in its sort order. Clients get it
+// encoded and must treat it as opaque, its format can change.
+type postCursor struct {
+	Sort postquery.Sort
+	postquery.Key
+}
+
+// encode writes the timestamp in microseconds, the precision Postgres stores it with. The count
+// is only meaningful for the count sorts but always written, so every cursor has the same shape.
+func (cursor postCursor) encode() string {
+	raw := string(cursor.Sort) + ":" + strconv.FormatInt(cursor.CreatedAt.UnixMicro(), 10) + ":" +
+		strconv.FormatInt(cursor.Count, 10) + ":" + strconv.FormatInt(int64(cursor.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePostCursor(s string) (postCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return postCursor{}, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 4 || !postquery.Sort(parts[0]).Valid() {
+		return postCursor{}, ErrInvalidCursor
+	}
+	createdAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return postCursor{}, ErrInvalidCursor
+	}
+	count, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || count < 0 {
+		return postCursor{}, ErrInvalidCursor
+	}
+	postID, err := strconv.ParseInt(parts[3], 10, 32)
+	if err != nil || postID < 1 {
+		return postCursor{}, ErrInvalidCursor
+	}
+	return postCursor{
+		Sort: postquery.Sort(parts[0]),
+		Key: postquery.Key{
+			CreatedAt: time.UnixMicro(createdAt),
+			Count:     count,
+			ID:        int32(postID),
+		},
+	}, nil
+}
+
+// searchCursor is the position of the last result of a search page in the (rank, id) order.
+type searchCursor struct {
+	Rank float32
+	ID   int32
+}
+
+// encode keeps the rank exact, the next page compares it with the rank Postgres computes again.
+func (cursor searchCursor) encode() string {
+	raw := strconv.FormatUint(uint64(math.Float32bits(cursor.Rank)), 16) + ":" + strconv.FormatInt(int64(cursor.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSearchCursor(s string) (searchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return searchCursor{}, ErrInvalidCursor
+	}
+	bits, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return searchCursor{}, ErrInvalidCursor
+	}
+	rank, err := strconv.ParseUint(bits, 16, 32)
+	if err != nil {
+		return searchCursor{}, ErrInvalidCursor
+	}
+	postID, err := strconv.ParseInt(id, 10, 32)
+	if err != nil || postID < 1 {
+		return searchCursor{}, ErrInvalidCursor
+	}
+	return searchCursor{Rank: math.Float32frombits(uint32(rank)), ID: int32(postID)}, nil
+}
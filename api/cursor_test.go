@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/postquery"
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+func TestPostCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.UTC)
+	tests := []postCursor{
+		{Sort: postquery.SortNewest, Key: postquery.Key{CreatedAt: createdAt, ID: 42}},
+		{Sort: postquery.SortOldest, Key: postquery.Key{CreatedAt: createdAt, ID: 1}},
+		{Sort: postquery.SortMostCommented, Key: postquery.Key{CreatedAt: createdAt, Count: 17, ID: 3}},
+		{Sort: postquery.SortMostReacted, Key: postquery.Key{CreatedAt: createdAt, Count: 0, ID: math.MaxInt32}},
+	}
+	for _, want := range tests {
+		got, err := decodePostCursor(want.encode())
+		if err != nil {
+			t.Fatalf("%s: %v", want.Sort, err)
+		}
+		if got.Sort != want.Sort || got.ID != want.ID || got.Count != want.Count || !got.CreatedAt.Equal(want.CreatedAt) {
+			t.Errorf("decoded %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestDecodePostCursorRejectsGarbage(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	tests := map[string]string{
+		"not base64":      "!!!",
+		"empty":           "",
+		"old format":      encode("newest:1714979289123456:42"),
+		"unknown sort":    encode("random:1714979289123456:0:42"),
+		"bad timestamp":   encode("newest:yesterday:0:42"),
+		"negative count":  encode("most_reacted:1714979289123456:-1:42"),
+		"id zero":         encode("newest:1714979289123456:0:0"),
+		"id out of range": encode("newest:1714979289123456:0:2147483648"),
+	}
+	for name, cursor := range tests {
+		if _, err := decodePostCursor(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: err = %v, want ErrInvalidCursor", name, err)
+		}
+	}
+}
+
+func TestSearchCursorRoundTrip(t *testing.T) {
+	for _, want := range []searchCursor{
+		{Rank: 0.0607927, ID: 12},
+		{Rank: 0, ID: 1},
+		{Rank: math.SmallestNonzeroFloat32, ID: 99},
+	} {
+		got, err := decodeSearchCursor(want.encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the rank must survive bit for bit, the next page compares it with what Postgres computes
+		if math.Float32bits(got.Rank) != math.Float32bits(want.Rank) || got.ID != want.ID {
+			t.Errorf("decoded %+v, want %+v", got, want)
+		}
+	}
+
+	if _, err := decodeSearchCursor(base64.RawURLEncoding.EncodeToString([]byte("zz:1"))); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("err = %v, want ErrInvalidCursor", err)
+	}
+}
+
+// newFeedServer returns a server whose feed query answers with rows and records its arguments.
+func newFeedServer(t *testing.T, rows []postquery.Row) (*Server, *fakeDB, string) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	// the feed query is built by hand and has no sqlc name
+	db.returns("unnamed", rows, nil)
+	db.returns("ListPostTags", []repo.PostTag{}, nil)
+	db.returns("ListPostReactionCounts", []repo.ListPostReactionCountsRow{}, nil)
+	return server, db, accessToken(t, server, testUser, "family")
+}
+
+func feedRows(n int, count func(i int) int64) []postquery.Row {
+	rows := make([]postquery.Row, n)
+	for i := range rows {
+		rows[i] = postquery.Row{
+			Post: repo.Post{
+				ID:        int32(100 - i),
+				Title:     fmt.Sprintf("post %d", 100-i),
+				UserID:    testUser.ID,
+				CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(-time.Duration(i) * time.Hour),
+			},
+			Count: count(i),
+		}
+	}
+	return rows
+}
+
+func TestListPostsPagesWithCursor(t *testing.T) {
+	// one row more than the page size tells there is a next page
+	rows := feedRows(6, func(i int) int64 { return int64(50 - i) })
+	server, db, token := newFeedServer(t, rows)
+
+	rec := serve(server, http.MethodGet, "/post?sort=most_reacted&page_size=5", "", token)
+	expectStatus(t, rec, http.StatusOK)
+	var page listPostsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Posts) != 5 {
+		t.Fatalf("%d posts, want 5", len(page.Posts))
+	}
+	cursor, err := decodePostCursor(page.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := rows[4]; cursor.Sort != postquery.SortMostReacted || cursor.ID != last.Post.ID || cursor.Count != last.Count {
+		t.Fatalf("next cursor = %+v, want the key of post %d", cursor, last.Post.ID)
+	}
+
+	// the next page continues after the cursor's count and id
+	expectStatus(t, serve(server, http.MethodGet, "/post?sort=most_reacted&page_size=5&cursor="+url.QueryEscape(page.NextCursor), "", token), http.StatusOK)
+	calls := db.called("unnamed")
+	args := calls[len(calls)-1]
+	if len(args) != 3 || args[0] != cursor.Count || args[1] != cursor.ID || args[2] != int32(6) {
+		t.Errorf("query arguments = %v, want the cursor's count and id and the limit", args)
+	}
+}
+
+func TestListPostsLastPageHasNoCursor(t *testing.T) {
+	server, _, token := newFeedServer(t, feedRows(3, func(int) int64 { return 0 }))
+
+	rec := serve(server, http.MethodGet, "/post?page_size=5", "", token)
+	expectStatus(t, rec, http.StatusOK)
+	var page map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := page["next_cursor"]; ok {
+		t.Errorf("last page has a next_cursor: %s", rec.Body.String())
+	}
+}
+
+func TestListPostsRejectsBadCursor(t *testing.T) {
+	server, _, token := newFeedServer(t, nil)
+	newest := postCursor{Sort: postquery.SortNewest, Key: postquery.Key{CreatedAt: time.Now(), ID: 1}}.encode()
+
+	for name, query := range map[string]string{
+		"garbage":      "cursor=garbage",
+		"other sort":   "sort=oldest&cursor=" + newest,
+		"unknown sort": "sort=random",
+		"page_id too":  "page_id=2&cursor=" + newest,
+		"bad tag":      "tag=" + url.QueryEscape("no spaces"),
+	} {
+		if rec := serve(server, http.MethodGet, "/post?"+query, "", token); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, rec.Code)
+		}
+	}
+}
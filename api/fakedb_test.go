@@ -0,0 +1,383 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/postquery"
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+	"github.com/Iknite-Space/sqlc-example-api/mailer"
+)
+
+// fakeQuery answers one sqlc query. For :one it returns the row, for :many a slice of rows and
+// for :exec and :execrows the number of rows affected as an int64. A row of a repo struct is
+// scanned field by field, in the order sqlc scans the columns.
+type fakeQuery func(args ...interface{}) (interface{}, error)
+
+// fakeDB stands in for Postgres: the test scripts the queries it expects by name and the
+// calls are recorded so the test can check what the handler did.
+type fakeDB struct {
+	t       *testing.T
+	mu      sync.Mutex
+	queries map[string]fakeQuery
+	calls   []fakeCall
+}
+
+type fakeCall struct {
+	name string
+	args []interface{}
+}
+
+func newFakeDB(t *testing.T) *fakeDB {
+	return &fakeDB{t: t, queries: make(map[string]fakeQuery)}
+}
+
+// on answers the named query with fn from now on.
+func (db *fakeDB) on(name string, fn fakeQuery) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.queries[name] = fn
+}
+
+// returns answers the named query with the same result every time.
+func (db *fakeDB) returns(name string, result interface{}, err error) {
+	db.on(name, func(...interface{}) (interface{}, error) { return result, err })
+}
+
+// called returns the arguments of every call of the named query.
+func (db *fakeDB) called(name string) [][]interface{} {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var args [][]interface{}
+	for _, call := range db.calls {
+		if call.name == name {
+			args = append(args, call.args)
+		}
+	}
+	return args
+}
+
+var queryNamePattern = regexp.MustCompile(`-- name: (\w+)`)
+
+func (db *fakeDB) answer(sql string, args []interface{}) (interface{}, error) {
+	name := "unnamed"
+	if m := queryNamePattern.FindStringSubmatch(sql); m != nil {
+		name = m[1]
+	}
+
+	db.mu.Lock()
+	db.calls = append(db.calls, fakeCall{name: name, args: args})
+	fn, ok := db.queries[name]
+	db.mu.Unlock()
+
+	if !ok {
+		db.t.Errorf("unexpected query %s", name)
+		return nil, fmt.Errorf("fake db: no answer for %s", name)
+	}
+	return fn(args...)
+}
+
+func (db *fakeDB) Exec(_ context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	result, err := db.answer(sql, args)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	rows, _ := result.(int64)
+	return pgconn.NewCommandTag(fmt.Sprintf("UPDATE %d", rows)), nil
+}
+
+func (db *fakeDB) Query(_ context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	result, err := db.answer(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	rows := &fakeRows{}
+	if result != nil {
+		value := reflect.ValueOf(result)
+		for i := 0; i < value.Len(); i++ {
+			rows.rows = append(rows.rows, fakeColumns(value.Index(i).Interface()))
+		}
+	}
+	return rows, nil
+}
+
+func (db *fakeDB) QueryRow(_ context.Context, sql string, args ...interface{}) pgx.Row {
+	result, err := db.answer(sql, args)
+	if err != nil {
+		return fakeRow{err: err}
+	}
+	return fakeRow{columns: fakeColumns(result)}
+}
+
+// Begin starts a fake transaction, its statements go to the same fakeDB. Commit and rollback
+// are recorded as calls named "commit" and "rollback".
+func (db *fakeDB) Begin(context.Context) (pgx.Tx, error) {
+	return &fakeTx{db: db}, nil
+}
+
+func (db *fakeDB) record(name string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.calls = append(db.calls, fakeCall{name: name})
+}
+
+type fakeTx struct {
+	db   *fakeDB
+	done bool
+}
+
+func (tx *fakeTx) Commit(context.Context) error {
+	if tx.done {
+		return pgx.ErrTxClosed
+	}
+	tx.done = true
+	tx.db.record("commit")
+	return nil
+}
+
+func (tx *fakeTx) Rollback(context.Context) error {
+	if tx.done {
+		return pgx.ErrTxClosed
+	}
+	tx.done = true
+	tx.db.record("rollback")
+	return nil
+}
+
+func (tx *fakeTx) Begin(ctx context.Context) (pgx.Tx, error) { return tx.db.Begin(ctx) }
+func (tx *fakeTx) LargeObjects() pgx.LargeObjects            { return pgx.LargeObjects{} }
+func (tx *fakeTx) Conn() *pgx.Conn                           { return nil }
+
+func (tx *fakeTx) CopyFrom(context.Context, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error) {
+	return 0, errors.New("fake db: CopyFrom is not supported")
+}
+
+func (tx *fakeTx) SendBatch(context.Context, *pgx.Batch) pgx.BatchResults {
+	tx.db.t.Error("fake db: SendBatch is not supported")
+	return nil
+}
+
+func (tx *fakeTx) Prepare(context.Context, string, string) (*pgconn.StatementDescription, error) {
+	return nil, errors.New("fake db: Prepare is not supported")
+}
+
+func (tx *fakeTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return tx.db.Exec(ctx, sql, args...)
+}
+
+func (tx *fakeTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return tx.db.Query(ctx, sql, args...)
+}
+
+func (tx *fakeTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return tx.db.QueryRow(ctx, sql, args...)
+}
+
+// rowPackages hold the structs queries scan into.
+var rowPackages = map[string]bool{
+	reflect.TypeOf(repo.User{}).PkgPath():     true,
+	reflect.TypeOf(postquery.Row{}).PkgPath(): true,
+}
+
+// fakeColumns splits a repo or postquery struct into its columns, any other value is a single
+// column. A repo struct embedded in a row, like the post of a postquery.Row, is split as well.
+func fakeColumns(row interface{}) []interface{} {
+	value := reflect.ValueOf(row)
+	if value.Kind() != reflect.Struct || !rowPackages[value.Type().PkgPath()] {
+		return []interface{}{row}
+	}
+	var columns []interface{}
+	for i := 0; i < value.NumField(); i++ {
+		columns = append(columns, fakeColumns(value.Field(i).Interface())...)
+	}
+	return columns
+}
+
+func fakeScan(columns []interface{}, dest []interface{}) error {
+	if len(columns) != len(dest) {
+		return fmt.Errorf("fake db: %d columns scanned into %d values", len(columns), len(dest))
+	}
+	for i, column := range columns {
+		target := reflect.ValueOf(dest[i]).Elem()
+		if column == nil {
+			target.Set(reflect.Zero(target.Type()))
+			continue
+		}
+		value := reflect.ValueOf(column)
+		if !value.Type().AssignableTo(target.Type()) {
+			return fmt.Errorf("fake db: cannot scan %T into %s", column, target.Type())
+		}
+		target.Set(value)
+	}
+	return nil
+}
+
+type fakeRow struct {
+	columns []interface{}
+	err     error
+}
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	return fakeScan(r.columns, dest)
+}
+
+type fakeRows struct {
+	rows [][]interface{}
+	next int
+}
+
+func (r *fakeRows) Close()                                       {}
+func (r *fakeRows) Err() error                                   { return nil }
+func (r *fakeRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *fakeRows) RawValues() [][]byte                          { return nil }
+func (r *fakeRows) Conn() *pgx.Conn                              { return nil }
+
+func (r *fakeRows) Next() bool {
+	if r.next >= len(r.rows) {
+		return false
+	}
+	r.next++
+	return true
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	if r.next == 0 {
+		return errors.New("fake db: Scan called before Next")
+	}
+	return fakeScan(r.rows[r.next-1], dest)
+}
+
+func (r *fakeRows) Values() ([]interface{}, error) {
+	return r.rows[r.next-1], nil
+}
+
+// newTestServer returns a server backed by a fake database.
+func newTestServer(t *testing.T) (*Server, *fakeDB) {
+	gin.SetMode(gin.TestMode)
+	db := newFakeDB(t)
+	server := NewAPIHandler(repo.New(db), "test-secret-that-is-long-enough-for-hs256")
+	server.Mailer = mailer.NewLogMailer(io.Discard)
+	server.DB = db
+	server.JWTIssuer = testIssuer
+	server.JWTAudience = testAudience
+	return server, db
+}
+
+// accessToken signs an access token for the user in the given login session.
+func accessToken(t *testing.T, server *Server, user repo.User, sessionID string) string {
+	token, err := server.generateToken(user.ID, user.Username, user.Role, sessionID, server.AccessTokenDuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// serve sends the request through the server's router.
+func serve(server *Server, method string, target string, body string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	server.WireHttpHandler().ServeHTTP(rec, req)
+	return rec
+}
+
+var testUser = repo.User{
+	ID:        7,
+	Username:  "alice",
+	Email:     "alice@example.com",
+	CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	Role:      RoleMember,
+}
+
+// verifiedUser is testUser once the email address is verified, before that the email domain that
+// admitted the account is not enough to log in.
+var verifiedUser = func() repo.User {
+	user := testUser
+	user.VerifiedAt = pgtype.Timestamptz{Time: testUser.CreatedAt.Add(time.Hour), Valid: true}
+	return user
+}()
+
+// expectStatus fails the test when the response does not have the wanted status.
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, want, rec.Body.String())
+	}
+}
+
+// fakeThrottles keeps the login_throttles table of a fakeDB, with the conditions of its queries.
+type fakeThrottles struct {
+	mu   sync.Mutex
+	rows map[string]repo.LoginThrottle
+}
+
+func newFakeThrottles(db *fakeDB) *fakeThrottles {
+	throttles := &fakeThrottles{rows: make(map[string]repo.LoginThrottle)}
+	db.on("GetLoginThrottle", func(args ...interface{}) (interface{}, error) {
+		throttles.mu.Lock()
+		defer throttles.mu.Unlock()
+		row, ok := throttles.rows[args[0].(string)]
+		if !ok {
+			return nil, pgx.ErrNoRows
+		}
+		return row, nil
+	})
+	db.on("RecordLoginFailure", func(args ...interface{}) (interface{}, error) {
+		throttles.mu.Lock()
+		defer throttles.mu.Unlock()
+		key, windowStart := args[0].(string), args[1].(time.Time)
+		row, ok := throttles.rows[key]
+		if !ok || row.LastFailureAt.Before(windowStart) {
+			row = repo.LoginThrottle{Key: key, LockedUntil: row.LockedUntil}
+		}
+		row.Failures++
+		row.LastFailureAt = time.Now()
+		throttles.rows[key] = row
+		return row, nil
+	})
+	db.on("LockLoginThrottle", func(args ...interface{}) (interface{}, error) {
+		throttles.mu.Lock()
+		defer throttles.mu.Unlock()
+		row := throttles.rows[args[0].(string)]
+		row.LockedUntil = args[1].(pgtype.Timestamptz)
+		throttles.rows[args[0].(string)] = row
+		return nil, nil
+	})
+	db.on("DeleteLoginThrottle", func(args ...interface{}) (interface{}, error) {
+		throttles.mu.Lock()
+		defer throttles.mu.Unlock()
+		delete(throttles.rows, args[0].(string))
+		return nil, nil
+	})
+	return throttles
+}
+
+func (throttles *fakeThrottles) get(key string) (repo.LoginThrottle, bool) {
+	throttles.mu.Lock()
+	defer throttles.mu.Unlock()
+	row, ok := throttles.rows[key]
+	return row, ok
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// a cheap argon2id so the tests stay fast, real servers use NewArgon2idHasher
+var testArgon2idHasher = Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+func TestCheckPasswordDetectsFormat(t *testing.T) {
+	bcryptHash, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argon2idHash, err := testArgon2idHasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     error
+	}{
+		{name: "bcrypt", hash: bcryptHash, password: "secret"},
+		{name: "bcrypt mismatch", hash: bcryptHash, password: "other", want: ErrPasswordMismatch},
+		// hashes made by other bcrypt implementations carry another minor version
+		{name: "bcrypt 2y", hash: "$2y$" + strings.TrimPrefix(bcryptHash, "$2a$"), password: "secret"},
+		{name: "argon2id", hash: argon2idHash, password: "secret"},
+		{name: "argon2id mismatch", hash: argon2idHash, password: "other", want: ErrPasswordMismatch},
+		{name: "argon2i", hash: strings.Replace(argon2idHash, "argon2id", "argon2i", 1), password: "secret", want: ErrUnknownPasswordHash},
+		{name: "argon2id other version", hash: strings.Replace(argon2idHash, "v=19", "v=16", 1), password: "secret", want: ErrUnknownPasswordHash},
+		{name: "argon2id truncated", hash: argon2idHash[:strings.LastIndex(argon2idHash, "$")], password: "secret", want: ErrUnknownPasswordHash},
+		{name: "plain text", hash: "secret", password: "secret", want: ErrUnknownPasswordHash},
+		{name: "empty", hash: "", password: "", want: ErrUnknownPasswordHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPassword(tt.password, tt.hash)
+			if tt.want == nil && err != nil {
+				t.Fatalf("CheckPassword = %v, want nil", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("CheckPassword = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestArgon2idHashFormat(t *testing.T) {
+	hash, err := testArgon2idHasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("hash = %q, want the PHC string format", hash)
+	}
+
+	other, err := testArgon2idHasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == other {
+		t.Error("two hashes of the same password are equal, the salt is not random")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptHash, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argon2idHash, err := testArgon2idHasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		hash   string
+		want   bool
+	}{
+		{name: "bcrypt same cost", hasher: BcryptHasher{Cost: bcrypt.MinCost}, hash: bcryptHash, want: false},
+		{name: "bcrypt other cost", hasher: BcryptHasher{Cost: bcrypt.MinCost + 1}, hash: bcryptHash, want: true},
+		{name: "bcrypt from argon2id", hasher: BcryptHasher{Cost: bcrypt.MinCost}, hash: argon2idHash, want: true},
+		{name: "argon2id same parameters", hasher: testArgon2idHasher, hash: argon2idHash, want: false},
+		{name: "argon2id more memory", hasher: Argon2idHasher{Memory: 2048, Iterations: 1, Parallelism: 1}, hash: argon2idHash, want: true},
+		{name: "argon2id from bcrypt", hasher: testArgon2idHasher, hash: bcryptHash, want: true},
+		{name: "unknown", hasher: testArgon2idHasher, hash: "secret", want: true},
+	}
+	for _, tt := range tests {
+		if got := tt.hasher.NeedsRehash(tt.hash); got != tt.want {
+			t.Errorf("%s: NeedsRehash = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoginUpgradesPasswordHash(t *testing.T) {
+	server, db, _ := newLoginServer(t)
+	db.returns("UpdateUserPasswordHash", nil, nil)
+	server.PasswordHasher = testArgon2idHasher
+
+	if status, _ := login(server, testUser.Email, "correct horse"); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+
+	calls := db.called("UpdateUserPasswordHash")
+	if len(calls) != 1 {
+		t.Fatalf("UpdateUserPasswordHash called %d times, want once", len(calls))
+	}
+	newHash := calls[0][0].(string)
+	if !strings.HasPrefix(newHash, argon2idPrefix) || CheckPassword("correct horse", newHash) != nil {
+		t.Errorf("stored hash %q is not an argon2id hash of the password", newHash)
+	}
+}
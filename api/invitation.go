@@ -0,0 +1,134 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+var (
+	ErrSignupNotAllowed  = errors.New("signup requires an allowed email domain or a valid invitation")
+	ErrInvalidInvitation = errors.New("invitation is invalid, expired or used up")
+)
+
+// emailDomainAllowed reports whether the domain of email is in the configured allowlist.
+func (server *Server) emailDomainAllowed(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+
+	for _, allowed := range server.AllowedEmailDomains {
+		if domain == strings.ToLower(strings.TrimSpace(allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// signupInvitation returns the invitation used for the signup, if any. Signup is allowed when the email
+// domain is allowed or a valid invitation is given, a code that is given but invalid is always refused.
+func (server *Server) signupInvitation(c *gin.Context, email string, code string) (*repo.Invitation, error) {
+	if code == "" {
+		if server.emailDomainAllowed(email) {
+			return nil, nil
+		}
+		return nil, ErrSignupNotAllowed
+	}
+
+	invitation, err := server.store.GetValidInvitation(c, hashToken(code))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// create invitation
+type createInvitationRequest struct {
+	MaxUses        int32 `json:"max_uses" binding:"omitempty,min=1,max=100"`
+	ExpiresInHours int32 `json:"expires_in_hours" binding:"omitempty,min=1,max=720"`
+}
+
+type invitationResponse struct {
+	ID        int32     `json:"id"`
+	Code      string    `json:"code,omitempty"` // only returned once, when the invitation is created
+	MaxUses   int32     `json:"max_uses"`
+	Uses      int32     `json:"uses"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newInvitationResponse(invitation repo.Invitation) invitationResponse {
+	return invitationResponse{
+		ID:        invitation.ID,
+		MaxUses:   invitation.MaxUses,
+		Uses:      invitation.Uses,
+		ExpiresAt: invitation.ExpiresAt,
+		CreatedAt: invitation.CreatedAt,
+	}
+}
+
+func (server *Server) createInvitation(c *gin.Context) {
+	var req createInvitationRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	// single use and valid for a week unless asked otherwise
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = 7 * 24
+	}
+
+	code, err := randomToken(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invitation"})
+		return
+	}
+
+	claims := authClaims(c)
+	invitation, err := server.store.CreateInvitation(c, repo.CreateInvitationParams{
+		CodeHash:  hashToken(code),
+		CreatedBy: claims.ID,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create invitation"})
+		return
+	}
+
+	rsp := newInvitationResponse(invitation)
+	rsp.Code = code
+	c.JSON(http.StatusCreated, rsp)
+}
+
+// list the invitations created by the caller
+func (server *Server) listInvitations(c *gin.Context) {
+	claims := authClaims(c)
+	invitations, err := server.store.ListInvitationsByCreator(c, claims.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve invitations"})
+		return
+	}
+
+	rsp := make([]invitationResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		rsp = append(rsp, newInvitationResponse(invitation))
+	}
+	c.JSON(http.StatusOK, rsp)
+}
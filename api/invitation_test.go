@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+const signupPassword = "tangerine-Quokka-93"
+
+// newSignupServer returns a server admitting iknite.com addresses, with the queries of a signup
+// that gets as far as sending the verification email.
+func newSignupServer(t *testing.T) (*Server, *fakeDB) {
+	server, db := newTestServer(t)
+	server.PasswordHasher = BcryptHasher{Cost: bcrypt.MinCost}
+	server.AllowedEmailDomains = []string{"iknite.com"}
+	db.on("CreateUser", func(args ...interface{}) (interface{}, error) {
+		return repo.User{ID: 8, Username: args[0].(string), Email: args[1].(string), InvitedBy: args[3].(*int32), Role: RoleMember}, nil
+	})
+	db.returns("InvalidateUserEmailVerificationTokens", nil, nil)
+	db.returns("CreateEmailVerificationToken", repo.EmailVerificationToken{}, nil)
+	return server, db
+}
+
+func signup(server *Server, email string, inviteCode string) int {
+	body, _ := json.Marshal(signupRequest{Username: "bob", Email: email, Password: signupPassword, InviteCode: inviteCode})
+	return serve(server, http.MethodPost, "/signup", string(body), "").Code
+}
+
+var testInvitation = repo.Invitation{
+	ID:        3,
+	CodeHash:  hashToken("invite-code"),
+	CreatedBy: 1,
+	MaxUses:   1,
+	ExpiresAt: time.Now().Add(time.Hour),
+}
+
+func TestSignupWithAllowedDomain(t *testing.T) {
+	server, db := newSignupServer(t)
+
+	if status := signup(server, "Bob@IKNITE.com", ""); status != http.StatusCreated {
+		t.Fatalf("status = %d, want 201", status)
+	}
+	created := db.called("CreateUser")
+	if len(created) != 1 || created[0][1] != "bob@iknite.com" || created[0][3].(*int32) != nil {
+		t.Errorf("CreateUser calls = %v, want bob@iknite.com without an inviter", created)
+	}
+	if len(db.called("CreateEmailVerificationToken")) != 1 {
+		t.Error("no verification email was sent")
+	}
+}
+
+func TestSignupRefusesOtherDomains(t *testing.T) {
+	server, db := newSignupServer(t)
+
+	if status := signup(server, "bob@example.com", ""); status != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", status)
+	}
+	// a subdomain or a lookalike is another domain
+	if status := signup(server, "bob@mail.iknite.com", ""); status != http.StatusForbidden {
+		t.Fatalf("subdomain: status = %d, want 403", status)
+	}
+	if len(db.called("CreateUser")) != 0 {
+		t.Error("a user was created")
+	}
+}
+
+func TestSignupWithInvitation(t *testing.T) {
+	server, db := newSignupServer(t)
+	db.returns("GetValidInvitation", testInvitation, nil)
+	db.returns("UseInvitation", int64(1), nil)
+
+	if status := signup(server, "bob@example.com", "invite-code"); status != http.StatusCreated {
+		t.Fatalf("status = %d, want 201", status)
+	}
+	if lookups := db.called("GetValidInvitation"); len(lookups) != 1 || lookups[0][0] != testInvitation.CodeHash {
+		t.Errorf("GetValidInvitation calls = %v, want the hash of the code", lookups)
+	}
+	created := db.called("CreateUser")
+	if len(created) != 1 || created[0][3].(*int32) == nil || *created[0][3].(*int32) != testInvitation.CreatedBy {
+		t.Errorf("CreateUser calls = %v, want the inviter recorded", created)
+	}
+	if used := db.called("UseInvitation"); len(used) != 1 || used[0][0] != testInvitation.ID {
+		t.Errorf("UseInvitation calls = %v", used)
+	}
+	if len(db.called("commit")) != 1 {
+		t.Error("the signup was not committed")
+	}
+}
+
+func TestSignupRefusesInvalidInvitation(t *testing.T) {
+	t.Run("unknown or expired", func(t *testing.T) {
+		server, db := newSignupServer(t)
+		db.returns("GetValidInvitation", nil, pgx.ErrNoRows)
+
+		// a wrong code is refused even for an allowed domain
+		if status := signup(server, "bob@iknite.com", "wrong-code"); status != http.StatusForbidden {
+			t.Fatalf("status = %d, want 403", status)
+		}
+		if len(db.called("CreateUser")) != 0 {
+			t.Error("a user was created")
+		}
+	})
+
+	t.Run("last use taken meanwhile", func(t *testing.T) {
+		server, db := newSignupServer(t)
+		db.returns("GetValidInvitation", testInvitation, nil)
+		db.returns("UseInvitation", int64(0), nil)
+
+		if status := signup(server, "bob@example.com", "invite-code"); status != http.StatusForbidden {
+			t.Fatalf("status = %d, want 403", status)
+		}
+		if len(db.called("rollback")) != 1 || len(db.called("commit")) != 0 {
+			t.Error("the user was created without an invitation")
+		}
+		if len(db.called("CreateEmailVerificationToken")) != 0 {
+			t.Error("a verification email was sent")
+		}
+	})
+}
+
+func TestLoginRequiresVerifiedEmailForDomainAccounts(t *testing.T) {
+	inviter := int32(1)
+	tests := []struct {
+		name      string
+		invitedBy *int32
+		verified  bool
+		require   bool
+		want      int
+	}{
+		{name: "domain account, unverified", want: http.StatusForbidden},
+		{name: "domain account, verified", verified: true, want: http.StatusOK},
+		{name: "invited account, unverified", invitedBy: &inviter, want: http.StatusOK},
+		{name: "invited account, unverified, verification required", invitedBy: &inviter, require: true, want: http.StatusForbidden},
+		{name: "invited account, verified, verification required", invitedBy: &inviter, verified: true, require: true, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, db, _ := newLoginServer(t)
+			server.RequireVerifiedEmail = tt.require
+			hash, err := server.PasswordHasher.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			user := testUser
+			user.HashedPassword = hash
+			user.InvitedBy = tt.invitedBy
+			if tt.verified {
+				user.VerifiedAt = verifiedUser.VerifiedAt
+			}
+			db.returns("GetUseryByEmail", user, nil)
+
+			if status, _ := login(server, user.Email, "correct horse"); status != tt.want {
+				t.Fatalf("status = %d, want %d", status, tt.want)
+			}
+			if issued := len(db.called("CreateSession")) == 1; issued != (tt.want == http.StatusOK) {
+				t.Errorf("tokens issued = %v", issued)
+			}
+		})
+	}
+}
+
+func TestRefreshRequiresVerifiedEmailForDomainAccounts(t *testing.T) {
+	server, db := newTestServer(t)
+	db.returns("GetSessionByTokenHash", repo.Session{
+		ID:        1,
+		UserID:    testUser.ID,
+		FamilyID:  "family",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}, nil)
+	db.returns("RevokeSession", int64(1), nil)
+	db.returns("GetUser", testUser, nil)
+
+	// a session from before the address had to be verified does not outlive it
+	if _, status := refresh(t, server, "token"); status != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", status)
+	}
+	if len(db.called("rollback")) != 1 {
+		t.Error("the old session was revoked anyway")
+	}
+}
+
+func TestCreateInvitation(t *testing.T) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	admin := testUser
+	admin.Role = RoleAdmin
+	db.returns("GetUser", admin, nil)
+	db.on("CreateInvitation", func(args ...interface{}) (interface{}, error) {
+		return repo.Invitation{ID: 3, CodeHash: args[0].(string), CreatedBy: args[1].(int32), MaxUses: args[2].(int32), ExpiresAt: args[3].(time.Time)}, nil
+	})
+
+	rec := serve(server, http.MethodPost, "/invitations", `{"max_uses": 5}`, accessToken(t, server, admin, "family"))
+	expectStatus(t, rec, http.StatusCreated)
+
+	var rsp invitationResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &rsp); err != nil {
+		t.Fatal(err)
+	}
+	created := db.called("CreateInvitation")
+	if len(created) != 1 || rsp.Code == "" || created[0][0] != hashToken(rsp.Code) {
+		t.Fatalf("only the hash of the returned code must be stored: %v, %q", created, rsp.Code)
+	}
+	if created[0][1] != admin.ID || rsp.MaxUses != 5 {
+		t.Errorf("invitation = %+v, created by %v", rsp, created[0][1])
+	}
+	// valid for a week by default
+	if expires := created[0][3].(time.Time); expires.Before(time.Now().Add(7*24*time.Hour-time.Minute)) || expires.After(time.Now().Add(7*24*time.Hour)) {
+		t.Errorf("expires at %s, want a week from now", expires)
+	}
+
+	// members cannot invite
+	expectStatus(t, serve(server, http.MethodPost, "/invitations", "", accessToken(t, server, testUser, "family")), http.StatusForbidden)
+}
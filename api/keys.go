@@ -0,0 +1,252 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKey is one key of the key set together with the algorithm it signs with. Retired keys
+// may be kept as their public half only, private is nil for them.
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// KeySet holds the asymmetric keys used to sign and verify access tokens. Only the active key
+// signs new tokens, the others stay published and accepted so tokens they signed keep working
+// while keys are rotated.
+type KeySet struct {
+	keys   map[string]*signingKey
+	active *signingKey
+}
+
+const (
+	// keyFileExt marks the key files of a key directory, the file name without it is the kid
+	keyFileExt = ".pem"
+	// publicKeyFileExt marks a key kept only to verify and publish, once its private half is destroyed
+	publicKeyFileExt = ".pub.pem"
+)
+
+// LoadKeySet reads PEM encoded RSA or Ed25519 keys from dir, one <kid>.pem private key or
+// <kid>.pub.pem public key file per key. Other files are ignored. Naming keys by their file keeps
+// kids and paths out of a list format, so neither has characters it cannot contain.
+func LoadKeySet(dir string, activeKID string) (*KeySet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key directory: %w", err)
+	}
+
+	ks := &KeySet{keys: make(map[string]*signingKey)}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, keyFileExt) {
+			continue
+		}
+		public := strings.HasSuffix(name, publicKeyFileExt)
+		kid := strings.TrimSuffix(name, keyFileExt)
+		if public {
+			kid = strings.TrimSuffix(name, publicKeyFileExt)
+		}
+		if _, ok := ks.keys[kid]; ok {
+			return nil, fmt.Errorf("key %q is in the directory twice", kid)
+		}
+
+		// #nosec G304 -- the key directory comes from the server configuration
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %q: %w", kid, err)
+		}
+		var key *signingKey
+		if public {
+			key, err = parsePublicKey(kid, data)
+		} else {
+			key, err = parseSigningKey(kid, data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %q: %w", kid, err)
+		}
+		ks.keys[kid] = key
+	}
+	if len(ks.keys) == 0 {
+		return nil, fmt.Errorf("no %s keys found in %s", keyFileExt, dir)
+	}
+
+	active, ok := ks.keys[activeKID]
+	if !ok {
+		return nil, fmt.Errorf("active key %q is not in the key set", activeKID)
+	}
+	if active.private == nil {
+		return nil, fmt.Errorf("active key %q has no private key to sign with", activeKID)
+	}
+	ks.active = active
+
+	return ks, nil
+}
+
+func parseSigningKey(kid string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	method, err := keyMethod(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{kid: kid, method: method, private: private, public: private.Public()}, nil
+}
+
+func parsePublicKey(kid string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	method, err := keyMethod(public)
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{kid: kid, method: method, public: public}, nil
+}
+
+// keyMethod returns the algorithm tokens signed with the key use.
+func keyMethod(public crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+}
+
+// GenerateToken signs the claims with the active key and sets the kid header.
+func (ks *KeySet) GenerateToken(claims UserClaims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	token.Header["kid"] = ks.active.kid
+
+	return token.SignedString(ks.active.private)
+}
+
+// VerifyToken checks a token signed by any key of the set for the issuer and audience and returns its claims.
+func (ks *KeySet) VerifyToken(tokenString string, issuer string, audience string) (*UserClaims, error) {
+	claims := &UserClaims{}
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		// the algorithm is pinned by the key, never by the token header
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+		}
+		return key.public, nil
+	}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	return checkClaims(claims)
+}
+
+// jwk is the public half of a key as published in the JWKS document (RFC 7517).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type jwksResponse struct {
+	Keys []jwk `json:"keys"`
+}
+
+// publicKeys returns the public keys of the set, sorted by kid so the document is stable.
+func (ks *KeySet) publicKeys() jwksResponse {
+	rsp := jwksResponse{Keys: []jwk{}}
+	if ks == nil {
+		return rsp
+	}
+
+	for _, key := range ks.keys {
+		k := jwk{Kid: key.kid, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			k.Kty = "RSA"
+			k.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			k.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			k.Kty = "OKP"
+			k.Crv = "Ed25519"
+			k.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		rsp.Keys = append(rsp.Keys, k)
+	}
+	sort.Slice(rsp.Keys, func(i, j int) bool { return rsp.Keys[i].Kid < rsp.Keys[j].Kid })
+
+	return rsp
+}
+
+// jwks publishes the public keys so other services can verify our tokens
+func (server *Server) jwks(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, server.Keys.publicKeys())
+}
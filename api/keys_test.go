@@ -0,0 +1,220 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeKey(t *testing.T, dir string, name string, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newKeyDir writes an RSA key as 2024-01.pem and an Ed25519 key as 2024-06.pem, in a directory
+// whose path has the characters a list format would have used as separators.
+func newKeyDir(t *testing.T) string {
+	dir := filepath.Join(t.TempDir(), "c:keys;v2")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, dir, "2024-01.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, dir, "2024-06.pem", "PRIVATE KEY", der)
+
+	// anything else in the directory is not a key
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("rotated every six months"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := newKeyDir(t)
+
+	old, err := LoadKeySet(dir, "2024-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := old.GenerateToken(testClaims(t, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// after the rotation the old key still verifies the tokens it signed
+	rotated, err := LoadKeySet(dir, "2024-06")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := rotated.VerifyToken(token, testIssuer, testAudience); err != nil || claims.Username != testUser.Username {
+		t.Fatalf("VerifyToken = %+v, %v", claims, err)
+	}
+
+	published := rotated.publicKeys().Keys
+	if len(published) != 2 || published[0].Kid != "2024-01" || published[0].Alg != "RS256" || published[1].Kid != "2024-06" || published[1].Alg != "EdDSA" {
+		t.Errorf("published keys = %+v", published)
+	}
+}
+
+func TestLoadKeySetKeepsRetiredPublicKeys(t *testing.T) {
+	dir := newKeyDir(t)
+	old, err := LoadKeySet(dir, "2024-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := old.GenerateToken(testClaims(t, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the private half of the retired key is destroyed, its public half stays until its tokens expired
+	private, err := os.ReadFile(filepath.Join(dir, "2024-01.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(private)
+	rsaKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "2024-01.pem")); err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, dir, "2024-01.pub.pem", "PUBLIC KEY", der)
+
+	rotated, err := LoadKeySet(dir, "2024-06")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotated.VerifyToken(token, testIssuer, testAudience); err != nil {
+		t.Errorf("token of the retired key: %v", err)
+	}
+	published := rotated.publicKeys().Keys
+	if len(published) != 2 || published[0].Kid != "2024-01" || published[0].Alg != "RS256" {
+		t.Errorf("published keys = %+v", published)
+	}
+
+	// a public key cannot sign
+	if _, err := LoadKeySet(dir, "2024-01"); err == nil {
+		t.Error("a public key was accepted as the active key")
+	}
+
+	// the same kid as private and public key is ambiguous
+	writeKey(t, dir, "2024-06.pub.pem", "PUBLIC KEY", der)
+	if _, err := LoadKeySet(dir, "2024-06"); err == nil {
+		t.Error("a kid with two key files was accepted")
+	}
+}
+
+const (
+	testIssuer   = "https://api.example.com"
+	testAudience = "iknite-connect-api"
+)
+
+// testClaims returns the claims of an access token for testUser from testIssuer to testAudience.
+func testClaims(t *testing.T, duration time.Duration) UserClaims {
+	t.Helper()
+	claims, err := newUserClaims(testIssuer, testAudience, testUser.ID, testUser.Username, testUser.Role, "family", duration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestVerifyTokenChecksIssuerAndAudience(t *testing.T) {
+	const secret = "test-secret-that-is-long-enough-for-hs256"
+	keys, err := LoadKeySet(newKeyDir(t), "2024-06")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signers := map[string]struct {
+		sign   func(UserClaims) (string, error)
+		verify func(token string) (*UserClaims, error)
+	}{
+		"shared secret": {
+			sign:   func(claims UserClaims) (string, error) { return GenerateToken(claims, secret) },
+			verify: func(token string) (*UserClaims, error) { return VerifyToken(token, secret, testIssuer, testAudience) },
+		},
+		"key set": {
+			sign:   keys.GenerateToken,
+			verify: func(token string) (*UserClaims, error) { return keys.VerifyToken(token, testIssuer, testAudience) },
+		},
+	}
+
+	tests := []struct {
+		name   string
+		change func(claims *UserClaims)
+		valid  bool
+	}{
+		{name: "ours", change: func(*UserClaims) {}, valid: true},
+		{name: "other issuer", change: func(claims *UserClaims) { claims.Issuer = "https://other.example.com" }},
+		{name: "no issuer", change: func(claims *UserClaims) { claims.Issuer = "" }},
+		{name: "other audience", change: func(claims *UserClaims) { claims.Audience = jwt.ClaimStrings{"billing-api"} }},
+		{name: "no audience", change: func(claims *UserClaims) { claims.Audience = nil }},
+	}
+	for signer, s := range signers {
+		for _, tt := range tests {
+			t.Run(signer+"/"+tt.name, func(t *testing.T) {
+				claims := testClaims(t, time.Minute)
+				tt.change(&claims)
+				token, err := s.sign(claims)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := s.verify(token); (err == nil) != tt.valid {
+					t.Errorf("VerifyToken err = %v, want valid %v", err, tt.valid)
+				}
+			})
+		}
+	}
+}
+
+func TestLoadKeySetRejects(t *testing.T) {
+	if _, err := LoadKeySet(newKeyDir(t), "2025-01"); err == nil {
+		t.Error("unknown active kid was accepted")
+	}
+	if _, err := LoadKeySet(t.TempDir(), "2024-01"); err == nil {
+		t.Error("empty directory was accepted")
+	}
+	if _, err := LoadKeySet(filepath.Join(t.TempDir(), "missing"), "2024-01"); err == nil {
+		t.Error("missing directory was accepted")
+	}
+
+	weak := t.TempDir()
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, weak, "2024-01.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(weakKey))
+	if _, err := LoadKeySet(weak, "2024-01"); err == nil {
+		t.Error("1024 bit RSA key was accepted")
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// newIdentifierLoginServer is newLoginServer with lookups that compare without case, like the
+// queries do with lower().
+func newIdentifierLoginServer(t *testing.T) (*Server, *fakeDB, *fakeThrottles) {
+	server, db, throttles := newLoginServer(t)
+	hash, err := server.PasswordHasher.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := verifiedUser
+	user.HashedPassword = hash
+	db.on("GetUseryByEmail", func(args ...interface{}) (interface{}, error) {
+		if !strings.EqualFold(args[0].(string), user.Email) {
+			return nil, pgx.ErrNoRows
+		}
+		return user, nil
+	})
+	db.on("GetUserByUsername", func(args ...interface{}) (interface{}, error) {
+		if !strings.EqualFold(args[0].(string), user.Username) {
+			return nil, pgx.ErrNoRows
+		}
+		return user, nil
+	})
+	return server, db, throttles
+}
+
+func TestLoginWithUsernameOrEmail(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		lookup string
+		arg    string
+		want   int
+	}{
+		{name: "username", body: `{"identifier": "alice", "password": "correct horse"}`, lookup: "GetUserByUsername", arg: "alice", want: http.StatusOK},
+		{name: "username in another case", body: `{"identifier": "ALICE", "password": "correct horse"}`, lookup: "GetUserByUsername", arg: "ALICE", want: http.StatusOK},
+		{name: "username with spaces", body: `{"identifier": " alice ", "password": "correct horse"}`, lookup: "GetUserByUsername", arg: "alice", want: http.StatusOK},
+		{name: "email", body: `{"identifier": "alice@example.com", "password": "correct horse"}`, lookup: "GetUseryByEmail", arg: "alice@example.com", want: http.StatusOK},
+		{name: "email in another case", body: `{"identifier": "Alice@EXAMPLE.com", "password": "correct horse"}`, lookup: "GetUseryByEmail", arg: "alice@example.com", want: http.StatusOK},
+		{name: "legacy email field", body: `{"email": "Alice@example.com", "password": "correct horse"}`, lookup: "GetUseryByEmail", arg: "alice@example.com", want: http.StatusOK},
+		{name: "identifier wins over email", body: `{"identifier": "alice", "email": "bob@example.com", "password": "correct horse"}`, lookup: "GetUserByUsername", arg: "alice", want: http.StatusOK},
+		{name: "unknown username", body: `{"identifier": "bob", "password": "correct horse"}`, lookup: "GetUserByUsername", arg: "bob", want: http.StatusUnauthorized},
+		{name: "wrong password", body: `{"identifier": "alice", "password": "wrong"}`, lookup: "GetUserByUsername", arg: "alice", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, db, _ := newIdentifierLoginServer(t)
+
+			expectStatus(t, serve(server, http.MethodPost, "/login", tt.body, ""), tt.want)
+			if lookups := db.called(tt.lookup); len(lookups) != 1 || lookups[0][0] != tt.arg {
+				t.Errorf("%s calls = %v, want one with %q", tt.lookup, lookups, tt.arg)
+			}
+		})
+	}
+}
+
+func TestLoginRequiresIdentifier(t *testing.T) {
+	server, db, _ := newIdentifierLoginServer(t)
+
+	expectStatus(t, serve(server, http.MethodPost, "/login", `{"password": "correct horse"}`, ""), http.StatusBadRequest)
+	expectStatus(t, serve(server, http.MethodPost, "/login", `{"email": "alice", "password": "correct horse"}`, ""), http.StatusBadRequest)
+	if len(db.called("GetUserByUsername"))+len(db.called("GetUseryByEmail")) != 0 {
+		t.Error("an invalid request looked a user up")
+	}
+}
+
+func TestLoginFailuresCountPerAccountWhateverTheIdentifier(t *testing.T) {
+	server, _, throttles := newIdentifierLoginServer(t)
+
+	for _, identifier := range []string{"alice", "ALICE@example.com"} {
+		if status, _ := login(server, identifier, "wrong"); status != http.StatusUnauthorized {
+			t.Fatalf("%s: status = %d, want 401", identifier, status)
+		}
+	}
+	// switching between username and email does not get more guesses
+	if row, ok := throttles.get(accountThrottleKey(testUser.Email)); !ok || row.Failures != 2 {
+		t.Errorf("account throttle = %+v, want both failures", row)
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	authorizationHeaderKey  = "authorization"
+	authorizationTypeBearer = "bearer"
+	authorizationPayloadKey = "authorization_payload"
+)
+
+// authMiddleware checks the Authorization: Bearer header, rejects revoked tokens
+// and stores the caller's claims in the context.
+func (server *Server) authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorizationHeader := c.GetHeader(authorizationHeaderKey)
+		if len(authorizationHeader) == 0 {
+			err := errors.New("authorization header is not provided")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		// the header must look like "Bearer <token>"
+		fields := strings.Fields(authorizationHeader)
+		if len(fields) != 2 {
+			err := errors.New("invalid authorization header format")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		authorizationType := strings.ToLower(fields[0])
+		if authorizationType != authorizationTypeBearer {
+			err := errors.New("unsupported authorization type")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		claims, err := server.verifyToken(fields[1])
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		revoked, err := server.revocations.isRevoked(c, claims)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check token"})
+			return
+		}
+		if revoked {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+			return
+		}
+
+		c.Set(authorizationPayloadKey, claims)
+		c.Next()
+	}
+}
+
+// authOrAPIKeyMiddleware accepts an X-API-Key header as well as a bearer token. For API keys the
+// claims are built from the key's owner and the key is stored in the context for requireScope.
+func (server *Server) authOrAPIKeyMiddleware() gin.HandlerFunc {
+	tokenAuth := server.authMiddleware()
+	return func(c *gin.Context) {
+		key := c.GetHeader(apiKeyHeaderKey)
+		if key == "" {
+			tokenAuth(c)
+			return
+		}
+
+		apiKey, user, err := server.authenticateAPIKey(c, key)
+		if err != nil {
+			if errors.Is(err, ErrInvalidAPIKey) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check api key"})
+			return
+		}
+
+		c.Set(authorizationPayloadKey, &UserClaims{ID: user.ID, Username: user.Username, Role: user.Role})
+		c.Set(apiKeyPayloadKey, apiKey)
+		c.Next()
+	}
+}
+
+// authClaims returns the claims stored by authMiddleware for the current request.
+func authClaims(c *gin.Context) *UserClaims {
+	return c.MustGet(authorizationPayloadKey).(*UserClaims)
+}
+
+// The roles a user can have, stored in users.role and copied into the access token.
+const (
+	RoleMember    = "member"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// requireRole only lets callers with one of the given roles through. It must run after authMiddleware.
+func requireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := authClaims(c)
+		for _, role := range roles {
+			if claims.Role == role {
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "you are not allowed to perform this action"})
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestPostRoutesRequireToken(t *testing.T) {
+	server, _ := newTestServer(t)
+	routes := []struct{ method, target string }{
+		{http.MethodPost, "/post"},
+		{http.MethodGet, "/post"},
+		{http.MethodGet, "/post/1"},
+		{http.MethodGet, "/posts/search?q=go"},
+		{http.MethodPut, "/posts"},
+		{http.MethodDelete, "/posts/1"},
+	}
+	// the fake database fails the test on any query, none may run before the caller is known
+	for _, route := range routes {
+		expectStatus(t, serve(server, route.method, route.target, "", ""), http.StatusUnauthorized)
+	}
+}
+
+func TestAuthMiddlewareRejects(t *testing.T) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+
+	sign := func(method jwt.SigningMethod, key interface{}, claims UserClaims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	claims := func(duration time.Duration) UserClaims {
+		claims, err := newUserClaims(server.JWTIssuer, server.JWTAudience, testUser.ID, testUser.Username, testUser.Role, "family", duration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return claims
+	}
+	withoutJTI := claims(time.Minute)
+	withoutJTI.RegisteredClaims.ID = ""
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "no header"},
+		{name: "other scheme", header: "Basic " + accessToken(t, server, testUser, "family")},
+		{name: "no token", header: "Bearer"},
+		{name: "extra field", header: "Bearer " + accessToken(t, server, testUser, "family") + " extra"},
+		{name: "not a jwt", header: "Bearer not-a-token"},
+		{name: "expired", header: "Bearer " + sign(jwt.SigningMethodHS256, []byte(server.JWTSecret), claims(-time.Minute))},
+		{name: "other secret", header: "Bearer " + sign(jwt.SigningMethodHS256, []byte("another-secret-that-is-long-enough!!"), claims(time.Minute))},
+		{name: "alg none", header: "Bearer " + sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims(time.Minute))},
+		{name: "HS384", header: "Bearer " + sign(jwt.SigningMethodHS384, []byte(server.JWTSecret), claims(time.Minute))},
+		{name: "no jti", header: "Bearer " + sign(jwt.SigningMethodHS256, []byte(server.JWTSecret), withoutJTI)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			server.WireHttpHandler().ServeHTTP(rec, req)
+			expectStatus(t, rec, http.StatusUnauthorized)
+		})
+	}
+
+	// the scheme is case-insensitive
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "bearer "+accessToken(t, server, testUser, "family"))
+	rec := httptest.NewRecorder()
+	server.WireHttpHandler().ServeHTTP(rec, req)
+	expectStatus(t, rec, http.StatusOK)
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+	"github.com/Iknite-Space/sqlc-example-api/mailer"
+)
+
+const passwordResetTokenDuration = time.Hour
+
+// forgot password
+type forgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+func (server *Server) forgotPassword(c *gin.Context) {
+	var req forgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the response is the same whether the email exists or not so it cannot be used to find accounts
+	rsp := gin.H{"message": "If an account exists for this email, a reset link has been sent"}
+
+	user, err := server.store.GetUseryByEmail(c, req.Email)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusAccepted, rsp)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	// only the latest link works
+	if err := server.store.InvalidateUserPasswordResetTokens(c, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create reset token"})
+		return
+	}
+	_, err = server.store.CreatePasswordResetToken(c, repo.CreatePasswordResetTokenParams{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(passwordResetTokenDuration),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	link, err := pageLink(server.PasswordResetURL, token)
+	if err != nil {
+		_ = c.Error(err)
+		c.JSON(http.StatusAccepted, rsp)
+		return
+	}
+	err = server.Mailer.Send(c, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your IkniteConnect password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this link to choose a new password, it expires in %s:\n\n%s\n\nIf you did not ask for this you can ignore this email.\n",
+			user.Username, passwordResetTokenDuration, link),
+	})
+	if err != nil {
+		// keep the generic response, the failure ends up in the request log
+		_ = c.Error(err)
+	}
+
+	c.JSON(http.StatusAccepted, rsp)
+}
+
+// pageLink adds the token to the query of a web app page. Emails link to the page, which posts the
+// token to the API, so the API only takes tokens in a POST body and they never end up in its access logs.
+func pageLink(page string, token string) (string, error) {
+	link, err := url.Parse(page)
+	if err != nil {
+		return "", err
+	}
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+	return link.String(), nil
+}
+
+// reset password
+type resetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+func (server *Server) resetPassword(c *gin.Context) {
+	var req resetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// look the token up without using it, a refused password must not cost the user their link
+	resetToken, err := server.store.GetValidPasswordResetToken(c, hashToken(req.Token))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	user, err := server.store.GetUser(c, resetToken.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	if !server.acceptablePassword(c, req.NewPassword, user.Username, user.Email) {
+		return
+	}
+
+	hashedPassword, err := server.PasswordHasher.Hash(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		return
+	}
+
+	// marking the token used is atomic, a second request with the same token finds no row
+	err = server.inTx(c, func(q *repo.Queries) error {
+		if _, err := q.UsePasswordResetToken(c, resetToken.TokenHash); err != nil {
+			return err
+		}
+		_, err := replacePassword(c, q, user, hashedPassword)
+		return err
+	})
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update password"})
+		return
+	}
+
+	// whoever knew the old password must not stay logged in
+	if err := server.revocations.revokeAllBefore(c, user.ID, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+// replacePassword sets the user's password hash and revokes the refresh tokens and API keys
+// issued under the old password. The access tokens are left to revokeAllBefore, once q is committed.
+func replacePassword(ctx context.Context, q *repo.Queries, user repo.User, hashedPassword string) (repo.User, error) {
+	user, err := q.UpdateUser(ctx, repo.UpdateUserParams{
+		ID:             user.ID,
+		Username:       user.Username,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		return repo.User{}, err
+	}
+	if err := q.RevokeUserSessions(ctx, user.ID); err != nil {
+		return repo.User{}, err
+	}
+	if err := q.RevokeUserAPIKeys(ctx, user.ID); err != nil {
+		return repo.User{}, err
+	}
+	return user, nil
+}
+
+// acceptablePassword answers 400 with the reasons when password breaks the policy for this account.
+func (server *Server) acceptablePassword(c *gin.Context, password string, accountInputs ...string) bool {
+	reasons, err := server.PasswordPolicy.Check(password, accountInputs...)
+	if err != nil {
+		// the breach list could not be read, the other rules still apply
+		_ = c.Error(err)
+	}
+	if len(reasons) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password does not meet the requirements", "reasons": reasons})
+		return false
+	}
+	return true
+}
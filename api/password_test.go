@@ -0,0 +1,107 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+var testResetToken = repo.PasswordResetToken{
+	ID:        1,
+	UserID:    testUser.ID,
+	TokenHash: hashToken("reset-token"),
+	ExpiresAt: time.Now().Add(time.Hour),
+}
+
+// newResetServer returns a server where "reset-token" resets testUser's password.
+func newResetServer(t *testing.T) (*Server, *fakeDB) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	server.PasswordHasher = BcryptHasher{Cost: bcrypt.MinCost}
+	db.returns("GetValidPasswordResetToken", testResetToken, nil)
+	db.returns("UsePasswordResetToken", testResetToken, nil)
+	db.on("UpdateUser", func(args ...interface{}) (interface{}, error) {
+		user := verifiedUser
+		user.HashedPassword = args[2].(string)
+		return user, nil
+	})
+	db.returns("RevokeUserSessions", nil, nil)
+	db.returns("RevokeUserAPIKeys", nil, nil)
+	return server, db
+}
+
+func resetPassword(server *Server, password string) int {
+	return serve(server, http.MethodPost, "/password/reset", `{"token": "reset-token", "new_password": "`+password+`"}`, "").Code
+}
+
+func TestResetPassword(t *testing.T) {
+	server, db := newResetServer(t)
+
+	if status := resetPassword(server, signupPassword); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	if used := db.called("UsePasswordResetToken"); len(used) != 1 || used[0][0] != testResetToken.TokenHash {
+		t.Errorf("UsePasswordResetToken calls = %v", used)
+	}
+	updated := db.called("UpdateUser")
+	if len(updated) != 1 || updated[0][0] != testUser.ID || CheckPassword(signupPassword, updated[0][2].(string)) != nil {
+		t.Fatalf("UpdateUser calls = %v, want the new password hashed", updated)
+	}
+	// whoever knew the old password loses their tokens and API keys
+	for _, name := range []string{"RevokeUserSessions", "RevokeUserAPIKeys", "SetTokensValidAfter"} {
+		if calls := db.called(name); len(calls) != 1 || calls[0][0] != testUser.ID {
+			t.Errorf("%s calls = %v, want one for the user", name, calls)
+		}
+	}
+	if len(db.called("commit")) != 1 {
+		t.Error("the reset was not committed")
+	}
+}
+
+func TestResetPasswordRejects(t *testing.T) {
+	t.Run("weak password", func(t *testing.T) {
+		server, db := newResetServer(t)
+
+		// the link still works for a second try
+		if status := resetPassword(server, "password"); status != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", status)
+		}
+		if len(db.called("UsePasswordResetToken")) != 0 {
+			t.Error("the token was used up")
+		}
+	})
+
+	t.Run("token used meanwhile", func(t *testing.T) {
+		server, db := newResetServer(t)
+		db.returns("UsePasswordResetToken", nil, pgx.ErrNoRows)
+
+		if status := resetPassword(server, signupPassword); status != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", status)
+		}
+		if len(db.called("UpdateUser")) != 0 || len(db.called("rollback")) != 1 {
+			t.Error("the password was changed")
+		}
+	})
+
+	t.Run("revoking the API keys fails", func(t *testing.T) {
+		server, db := newResetServer(t)
+		db.returns("RevokeUserAPIKeys", nil, errors.New("connection reset"))
+
+		if status := resetPassword(server, signupPassword); status != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want 500", status)
+		}
+		// the token is not used up and the password not changed
+		if len(db.called("rollback")) != 1 || len(db.called("commit")) != 0 {
+			t.Error("the reset was not rolled back")
+		}
+		if len(db.called("SetTokensValidAfter")) != 0 {
+			t.Error("the reset went on after the rollback")
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+// newPostServer returns a server that answers the tag and reaction lookups of a post response,
+// with an access token for testUser.
+func newPostServer(t *testing.T) (*Server, *fakeDB, string) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	db.returns("ListPostTags", []repo.PostTag{}, nil)
+	db.returns("ListPostReactionCounts", []repo.ListPostReactionCountsRow{}, nil)
+	return server, db, accessToken(t, server, testUser, "family")
+}
+
+func TestCreatePostTakesAuthorFromToken(t *testing.T) {
+	server, db, token := newPostServer(t)
+	db.on("CreatePost", func(args ...interface{}) (interface{}, error) {
+		return repo.Post{ID: 1, Title: args[0].(string), Content: args[1].(string), UserID: args[2].(int32), CreatedAt: time.Now()}, nil
+	})
+
+	// a user_id in the body is not a field of the request and cannot pick the author
+	rec := serve(server, http.MethodPost, "/post", `{"title": "Hello", "content": "World", "user_id": 1}`, token)
+	expectStatus(t, rec, http.StatusCreated)
+
+	var post postResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &post); err != nil {
+		t.Fatal(err)
+	}
+	if post.UserID != testUser.ID {
+		t.Errorf("author = %d, want the caller %d", post.UserID, testUser.ID)
+	}
+}
+
+func TestUpdatePostOnlyByAuthor(t *testing.T) {
+	server, db, token := newPostServer(t)
+	// the query only matches the post when the caller wrote it
+	db.on("UpdatePost", func(args ...interface{}) (interface{}, error) {
+		if args[0].(int32) != 1 || args[1].(int32) != testUser.ID {
+			return nil, pgx.ErrNoRows
+		}
+		return repo.Post{ID: 1, UserID: testUser.ID, Title: args[2].(string), Content: args[3].(string)}, nil
+	})
+
+	expectStatus(t, serve(server, http.MethodPut, "/posts", `{"id": 1, "title": "Edited", "content": "Text"}`, token), http.StatusOK)
+
+	// someone else's post looks like a missing one
+	other := testUser
+	other.ID = 8
+	other.Username = "mallory"
+	expectStatus(t, serve(server, http.MethodPut, "/posts", `{"id": 1, "title": "Mine now", "content": "Text"}`, accessToken(t, server, other, "family")), http.StatusNotFound)
+
+	calls := db.called("UpdatePost")
+	if len(calls) != 2 || calls[1][1] != other.ID {
+		t.Errorf("UpdatePost calls = %v, want the second scoped to the other user", calls)
+	}
+}
+
+func TestDeletePostOnlyByAuthor(t *testing.T) {
+	server, db, token := newPostServer(t)
+	db.on("DeletePost", func(args ...interface{}) (interface{}, error) {
+		if args[0].(int32) != 1 || args[1].(int32) != testUser.ID {
+			return int64(0), nil
+		}
+		return int64(1), nil
+	})
+
+	other := testUser
+	other.ID = 8
+	expectStatus(t, serve(server, http.MethodDelete, "/posts/1", "", accessToken(t, server, other, "family")), http.StatusNotFound)
+	expectStatus(t, serve(server, http.MethodDelete, "/posts/1", "", token), http.StatusOK)
+
+	if calls := db.called("DeletePost"); len(calls) != 2 || calls[0][1] != other.ID || calls[1][1] != testUser.ID {
+		t.Errorf("DeletePost calls = %v, want each scoped to the caller", calls)
+	}
+}
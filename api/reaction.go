@@ -0,0 +1,115 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+// reactionCount is how many people reacted to a post one way.
+type reactionCount struct {
+	Reaction string `json:"reaction"`
+	Count    int32  `json:"count"`
+	Reacted  bool   `json:"reacted"` // whether the caller is one of them
+}
+
+// reactionCounts returns the reactions of each post, posts nobody reacted to are left out.
+func (server *Server) reactionCounts(c *gin.Context, postIDs []int32) (map[int32][]reactionCount, error) {
+	counts := make(map[int32][]reactionCount, len(postIDs))
+	if len(postIDs) == 0 {
+		return counts, nil
+	}
+
+	rows, err := server.store.ListPostReactionCounts(c, repo.ListPostReactionCountsParams{
+		UserID:  authClaims(c).ID,
+		PostIds: postIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.PostID] = append(counts[row.PostID], reactionCount{
+			Reaction: row.Reaction,
+			Count:    row.Count,
+			Reacted:  row.Reacted,
+		})
+	}
+	return counts, nil
+}
+
+// react to a post, or take the reaction back. Both can be repeated safely.
+// The reactions are the ones post_reactions_reaction_check allows.
+type postReactionRequest struct {
+	ID       int32  `uri:"id" binding:"required,min=1"`
+	Reaction string `uri:"reaction" binding:"required,oneof=like love laugh celebrate insightful sad"`
+}
+
+func (server *Server) addReaction(c *gin.Context) {
+	var uri postReactionRequest
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !server.postExists(c, uri.ID) {
+		return
+	}
+
+	err := server.store.AddPostReaction(c, repo.AddPostReactionParams{
+		PostID:   uri.ID,
+		UserID:   authClaims(c).ID,
+		Reaction: uri.Reaction,
+	})
+	if err != nil {
+		// the post was deleted in the meantime
+		if isForeignKeyViolation(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "post not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add reaction"})
+		return
+	}
+
+	server.sendReactions(c, uri.ID)
+}
+
+func (server *Server) removeReaction(c *gin.Context) {
+	var uri postReactionRequest
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !server.postExists(c, uri.ID) {
+		return
+	}
+
+	err := server.store.RemovePostReaction(c, repo.RemovePostReactionParams{
+		PostID:   uri.ID,
+		UserID:   authClaims(c).ID,
+		Reaction: uri.Reaction,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove reaction"})
+		return
+	}
+
+	server.sendReactions(c, uri.ID)
+}
+
+// sendReactions answers with the post's reactions as they are now.
+func (server *Server) sendReactions(c *gin.Context, postID int32) {
+	counts, err := server.reactionCounts(c, []int32{postID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve reactions"})
+		return
+	}
+
+	reactions := counts[postID]
+	if reactions == nil {
+		reactions = make([]reactionCount, 0)
+	}
+	c.JSON(http.StatusOK, gin.H{"post_id": postID, "reactions": reactions})
+}
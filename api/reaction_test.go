@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+// otherUserID is someone reacting to the same post as testUser.
+var otherUserID = testUser.ID + 1
+
+type fakeReaction struct {
+	postID   int32
+	userID   int32
+	reaction string
+}
+
+// newReactionServer returns a server holding post 1 and the reactions the table would, keyed
+// like its primary key, and an access token for testUser.
+func newReactionServer(t *testing.T) (*Server, *fakeDB, map[fakeReaction]bool, string) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	reactions := map[fakeReaction]bool{}
+	db.on("GetPost", func(args ...interface{}) (interface{}, error) {
+		if args[0].(int32) != 1 {
+			return nil, pgx.ErrNoRows
+		}
+		return repo.Post{ID: 1, Title: "Hello", Content: "World", UserID: otherUserID}, nil
+	})
+	db.on("AddPostReaction", func(args ...interface{}) (interface{}, error) {
+		reactions[fakeReaction{args[0].(int32), args[1].(int32), args[2].(string)}] = true
+		return nil, nil
+	})
+	db.on("RemovePostReaction", func(args ...interface{}) (interface{}, error) {
+		delete(reactions, fakeReaction{args[0].(int32), args[1].(int32), args[2].(string)})
+		return nil, nil
+	})
+	db.on("ListPostReactionCounts", func(args ...interface{}) (interface{}, error) {
+		counts := map[string]*repo.ListPostReactionCountsRow{}
+		for r := range reactions {
+			row, ok := counts[r.reaction]
+			if !ok {
+				row = &repo.ListPostReactionCountsRow{PostID: r.postID, Reaction: r.reaction}
+				counts[r.reaction] = row
+			}
+			row.Count++
+			row.Reacted = row.Reacted || r.userID == args[0].(int32)
+		}
+		rows := []repo.ListPostReactionCountsRow{}
+		for _, row := range counts {
+			rows = append(rows, *row)
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i].Reaction < rows[j].Reaction })
+		return rows, nil
+	})
+	return server, db, reactions, accessToken(t, server, testUser, "family")
+}
+
+type reactionsResponse struct {
+	PostID    int32           `json:"post_id"`
+	Reactions []reactionCount `json:"reactions"`
+}
+
+func react(t *testing.T, server *Server, method string, target string, token string) reactionsResponse {
+	t.Helper()
+	rec := serve(server, method, target, "", token)
+	expectStatus(t, rec, http.StatusOK)
+	var rsp reactionsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &rsp); err != nil {
+		t.Fatal(err)
+	}
+	return rsp
+}
+
+func TestAddReaction(t *testing.T) {
+	server, db, reactions, token := newReactionServer(t)
+	reactions[fakeReaction{1, otherUserID, "like"}] = true
+
+	// adding the same reaction again changes nothing
+	for i := 0; i < 2; i++ {
+		rsp := react(t, server, http.MethodPut, "/posts/1/reactions/like", token)
+		if rsp.PostID != 1 || len(rsp.Reactions) != 1 || rsp.Reactions[0] != (reactionCount{Reaction: "like", Count: 2, Reacted: true}) {
+			t.Errorf("reactions = %+v, want the caller's like counted once", rsp.Reactions)
+		}
+	}
+	rsp := react(t, server, http.MethodPut, "/posts/1/reactions/celebrate", token)
+	if len(rsp.Reactions) != 2 || rsp.Reactions[0].Reaction != "celebrate" || rsp.Reactions[0].Count != 1 {
+		t.Errorf("reactions = %+v, want a like and a celebrate", rsp.Reactions)
+	}
+
+	added := db.called("AddPostReaction")
+	if len(added) != 3 || added[0][0] != int32(1) || added[0][1] != testUser.ID || added[0][2] != "like" {
+		t.Errorf("AddPostReaction calls = %v, want the caller as the one reacting", added)
+	}
+}
+
+func TestRemoveReaction(t *testing.T) {
+	server, db, reactions, token := newReactionServer(t)
+	reactions[fakeReaction{1, testUser.ID, "like"}] = true
+	reactions[fakeReaction{1, otherUserID, "like"}] = true
+
+	rsp := react(t, server, http.MethodDelete, "/posts/1/reactions/like", token)
+	if len(rsp.Reactions) != 1 || rsp.Reactions[0] != (reactionCount{Reaction: "like", Count: 1, Reacted: false}) {
+		t.Errorf("reactions = %+v, want only the other user's like", rsp.Reactions)
+	}
+	// removing a reaction that is not there is not an error
+	rsp = react(t, server, http.MethodDelete, "/posts/1/reactions/love", token)
+	if len(rsp.Reactions) != 1 {
+		t.Errorf("reactions = %+v", rsp.Reactions)
+	}
+
+	if removed := db.called("RemovePostReaction"); len(removed) != 2 || removed[0][1] != testUser.ID {
+		t.Errorf("RemovePostReaction calls = %v, want the caller's reactions only", removed)
+	}
+	if !reactions[fakeReaction{1, otherUserID, "like"}] {
+		t.Error("the other user's reaction was removed")
+	}
+}
+
+func TestReactionEmptyList(t *testing.T) {
+	server, _, _, token := newReactionServer(t)
+
+	rec := serve(server, http.MethodDelete, "/posts/1/reactions/like", "", token)
+	expectStatus(t, rec, http.StatusOK)
+	if got := rec.Body.String(); got != `{"post_id":1,"reactions":[]}` {
+		t.Errorf("body = %s, want an empty list rather than null", got)
+	}
+}
+
+func TestReactionRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{name: "unknown reaction", method: http.MethodPut, target: "/posts/1/reactions/angry", want: http.StatusBadRequest},
+		{name: "remove unknown reaction", method: http.MethodDelete, target: "/posts/1/reactions/angry", want: http.StatusBadRequest},
+		{name: "bad post id", method: http.MethodPut, target: "/posts/0/reactions/like", want: http.StatusBadRequest},
+		{name: "missing post", method: http.MethodPut, target: "/posts/2/reactions/like", want: http.StatusNotFound},
+		{name: "remove on missing post", method: http.MethodDelete, target: "/posts/2/reactions/like", want: http.StatusNotFound},
+		{name: "no token", method: http.MethodPut, target: "/posts/1/reactions/like", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, db, _, token := newReactionServer(t)
+			if tt.want == http.StatusUnauthorized {
+				token = ""
+			}
+
+			expectStatus(t, serve(server, tt.method, tt.target, "", token), tt.want)
+			if len(db.called("AddPostReaction"))+len(db.called("RemovePostReaction")) != 0 {
+				t.Error("the reactions changed")
+			}
+		})
+	}
+}
+
+func TestAddReactionToPostDeletedMeanwhile(t *testing.T) {
+	server, db, _, token := newReactionServer(t)
+	db.returns("AddPostReaction", nil, &pgconn.PgError{Code: "23503"})
+
+	expectStatus(t, serve(server, http.MethodPut, "/posts/1/reactions/like", "", token), http.StatusNotFound)
+}
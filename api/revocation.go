@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+// revocationCacheTTL bounds how long a logout done through another instance can go unnoticed here.
+const revocationCacheTTL = 30 * time.Second
+
+type cachedRevocation struct {
+	revoked   bool
+	checkedAt time.Time
+	expiresAt time.Time
+}
+
+type cachedCutoff struct {
+	cutoff    time.Time
+	checkedAt time.Time
+}
+
+// tokenRevoker keeps the JTI denylist, the per user "tokens valid after" cutoff and the revoked
+// login sessions in Postgres and caches lookups in memory so the auth middleware does not hit
+// the database on every request.
+type tokenRevoker struct {
+	store     *repo.Queries
+	mu        sync.Mutex
+	tokens    map[string]cachedRevocation
+	cutoffs   map[int32]cachedCutoff
+	sessions  map[string]cachedRevocation
+	lastSweep time.Time
+}
+
+func newTokenRevoker(store *repo.Queries) *tokenRevoker {
+	return &tokenRevoker{
+		store:    store,
+		tokens:   make(map[string]cachedRevocation),
+		cutoffs:  make(map[int32]cachedCutoff),
+		sessions: make(map[string]cachedRevocation),
+	}
+}
+
+// isRevoked reports whether the token was logged out or issued before the user's cutoff.
+func (r *tokenRevoker) isRevoked(ctx context.Context, claims *UserClaims) (bool, error) {
+	now := time.Now()
+	jti := claims.RegisteredClaims.ID
+
+	r.mu.Lock()
+	entry, ok := r.tokens[jti]
+	r.mu.Unlock()
+	if !ok || (!entry.revoked && now.Sub(entry.checkedAt) > revocationCacheTTL) {
+		revoked, err := r.store.IsTokenRevoked(ctx, jti)
+		if err != nil {
+			return false, err
+		}
+		entry = cachedRevocation{revoked: revoked, checkedAt: now, expiresAt: claims.ExpiresAt.Time}
+		r.mu.Lock()
+		r.tokens[jti] = entry
+		r.sweep(now)
+		r.mu.Unlock()
+	}
+	if entry.revoked {
+		return true, nil
+	}
+
+	cutoff, err := r.cutoff(ctx, claims.ID, now)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			// the user no longer exists
+			return true, nil
+		}
+		return false, err
+	}
+
+	if !cutoff.IsZero() && claims.IssuedAt.Time.Before(cutoff) {
+		return true, nil
+	}
+
+	// tokens from before login sessions existed have no sid, they expire soon enough
+	if claims.SessionID == "" {
+		return false, nil
+	}
+	return r.sessionRevoked(ctx, claims, now)
+}
+
+// sessionRevoked checks the login session of the token. The lookup also records when the session
+// was last seen, so last_seen_at is as precise as the cache TTL.
+func (r *tokenRevoker) sessionRevoked(ctx context.Context, claims *UserClaims, now time.Time) (bool, error) {
+	r.mu.Lock()
+	entry, ok := r.sessions[claims.SessionID]
+	r.mu.Unlock()
+	if ok && (entry.revoked || now.Sub(entry.checkedAt) <= revocationCacheTTL) {
+		return entry.revoked, nil
+	}
+
+	revokedAt, err := r.store.TouchLoginSession(ctx, claims.SessionID)
+	if err != nil && err != pgx.ErrNoRows {
+		return false, err
+	}
+	// every family has a row, the migration recorded the ones that predate it, so a missing row
+	// means the session was deleted with its user
+	entry = cachedRevocation{revoked: err == pgx.ErrNoRows || revokedAt.Valid, checkedAt: now, expiresAt: claims.ExpiresAt.Time}
+	r.mu.Lock()
+	r.sessions[claims.SessionID] = entry
+	r.mu.Unlock()
+
+	return entry.revoked, nil
+}
+
+// revokeSession marks a login session revoked here right away, other instances notice within the cache TTL.
+func (r *tokenRevoker) revokeSession(sessionID string, until time.Time) {
+	r.mu.Lock()
+	r.sessions[sessionID] = cachedRevocation{revoked: true, checkedAt: time.Now(), expiresAt: until}
+	r.mu.Unlock()
+}
+
+func (r *tokenRevoker) cutoff(ctx context.Context, userID int32, now time.Time) (time.Time, error) {
+	r.mu.Lock()
+	entry, ok := r.cutoffs[userID]
+	r.mu.Unlock()
+	if ok && now.Sub(entry.checkedAt) <= revocationCacheTTL {
+		return entry.cutoff, nil
+	}
+
+	validAfter, err := r.store.GetTokensValidAfter(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	entry = cachedCutoff{checkedAt: now}
+	if validAfter.Valid {
+		entry.cutoff = validAfter.Time
+	}
+	r.mu.Lock()
+	r.cutoffs[userID] = entry
+	r.mu.Unlock()
+
+	return entry.cutoff, nil
+}
+
+// revoke adds a single token to the denylist.
+func (r *tokenRevoker) revoke(ctx context.Context, claims *UserClaims) error {
+	err := r.store.RevokeToken(ctx, repo.RevokeTokenParams{
+		Jti:       claims.RegisteredClaims.ID,
+		UserID:    claims.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.tokens[claims.RegisteredClaims.ID] = cachedRevocation{revoked: true, checkedAt: time.Now(), expiresAt: claims.ExpiresAt.Time}
+	r.mu.Unlock()
+
+	// expired entries are useless, tokens past their exp are rejected anyway
+	return r.store.DeleteExpiredRevokedTokens(ctx)
+}
+
+// revokeAllBefore invalidates every token the user was issued before the given time.
+func (r *tokenRevoker) revokeAllBefore(ctx context.Context, userID int32, before time.Time) error {
+	// iat only has second precision, without truncating a token issued right after this call
+	// (like the one handed back after a password change) would count as issued before it
+	before = before.Truncate(time.Second)
+
+	err := r.store.SetTokensValidAfter(ctx, repo.SetTokensValidAfterParams{
+		ID:               userID,
+		TokensValidAfter: pgtype.Timestamptz{Time: before, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cutoffs[userID] = cachedCutoff{cutoff: before, checkedAt: time.Now()}
+	r.mu.Unlock()
+
+	return nil
+}
+
+// sweep drops cache entries for tokens that have expired. The caller must hold r.mu.
+func (r *tokenRevoker) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < time.Minute {
+		return
+	}
+	r.lastSweep = now
+
+	for jti, entry := range r.tokens {
+		if now.After(entry.expiresAt) {
+			delete(r.tokens, jti)
+		}
+	}
+	for sessionID, entry := range r.sessions {
+		// revoked sessions are remembered as long as a token of theirs can still be valid
+		if now.After(entry.expiresAt) || (!entry.revoked && now.Sub(entry.checkedAt) > revocationCacheTTL) {
+			delete(r.sessions, sessionID)
+		}
+	}
+	for userID, entry := range r.cutoffs {
+		if now.Sub(entry.checkedAt) > revocationCacheTTL {
+			delete(r.cutoffs, userID)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fakeRevocations keeps the revoked_tokens table and the users' cutoff of a fakeDB.
+type fakeRevocations struct {
+	mu     sync.Mutex
+	jtis   map[string]bool
+	cutoff pgtype.Timestamptz
+}
+
+func newFakeRevocations(db *fakeDB) *fakeRevocations {
+	revocations := &fakeRevocations{jtis: make(map[string]bool)}
+	db.on("RevokeToken", func(args ...interface{}) (interface{}, error) {
+		revocations.mu.Lock()
+		defer revocations.mu.Unlock()
+		revocations.jtis[args[0].(string)] = true
+		return nil, nil
+	})
+	db.on("IsTokenRevoked", func(args ...interface{}) (interface{}, error) {
+		revocations.mu.Lock()
+		defer revocations.mu.Unlock()
+		return revocations.jtis[args[0].(string)], nil
+	})
+	db.on("SetTokensValidAfter", func(args ...interface{}) (interface{}, error) {
+		revocations.mu.Lock()
+		defer revocations.mu.Unlock()
+		revocations.cutoff = args[1].(pgtype.Timestamptz)
+		return nil, nil
+	})
+	db.on("GetTokensValidAfter", func(...interface{}) (interface{}, error) {
+		revocations.mu.Lock()
+		defer revocations.mu.Unlock()
+		return revocations.cutoff, nil
+	})
+	db.returns("DeleteExpiredRevokedTokens", nil, nil)
+	db.returns("TouchLoginSession", pgtype.Timestamptz{}, nil)
+	db.returns("GetUser", testUser, nil)
+	return revocations
+}
+
+// issuedAt signs an access token for testUser that claims to be issued at the given time.
+func issuedAt(t *testing.T, server *Server, at time.Time) string {
+	claims, err := newUserClaims(server.JWTIssuer, server.JWTAudience, testUser.ID, testUser.Username, testUser.Role, "family", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims.IssuedAt = jwt.NewNumericDate(at)
+	token, err := GenerateToken(claims, server.JWTSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	token := accessToken(t, server, testUser, "family")
+
+	expectStatus(t, serve(server, http.MethodGet, "/me", "", token), http.StatusOK)
+	expectStatus(t, serve(server, http.MethodPost, "/logout", "", token), http.StatusOK)
+	expectStatus(t, serve(server, http.MethodGet, "/me", "", token), http.StatusUnauthorized)
+
+	// another instance sharing the database refuses the token as well
+	other := NewAPIHandler(server.store, server.JWTSecret)
+	expectStatus(t, serve(other, http.MethodGet, "/me", "", token), http.StatusUnauthorized)
+
+	// other tokens of the user are not affected
+	expectStatus(t, serve(server, http.MethodGet, "/me", "", accessToken(t, server, testUser, "family")), http.StatusOK)
+}
+
+func TestLogoutAllRevokesEarlierTokens(t *testing.T) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	db.returns("RevokeUserSessionsBefore", nil, nil)
+	earlier := issuedAt(t, server, time.Now().Add(-time.Minute))
+	current := accessToken(t, server, testUser, "family")
+
+	expectStatus(t, serve(server, http.MethodPost, "/logout/all", "", current), http.StatusOK)
+
+	expectStatus(t, serve(server, http.MethodGet, "/me", "", earlier), http.StatusUnauthorized)
+	other := NewAPIHandler(server.store, server.JWTSecret)
+	expectStatus(t, serve(other, http.MethodGet, "/me", "", earlier), http.StatusUnauthorized)
+
+	// a token issued in the same second as the cutoff, like the one after a password change, stays valid
+	expectStatus(t, serve(server, http.MethodGet, "/me", "", accessToken(t, server, testUser, "family")), http.StatusOK)
+}
+
+func TestLogoutAllBeforeKeepsLaterSessions(t *testing.T) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	db.returns("RevokeUserSessionsBefore", nil, nil)
+	before := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	body := `{"before": "` + before.Format(time.RFC3339) + `"}`
+	expectStatus(t, serve(server, http.MethodPost, "/logout/all", body, accessToken(t, server, testUser, "family")), http.StatusOK)
+
+	// the refresh tokens get the same cutoff as the access tokens
+	calls := db.called("RevokeUserSessionsBefore")
+	if len(calls) != 1 {
+		t.Fatalf("RevokeUserSessionsBefore called %d times, want once", len(calls))
+	}
+	if arg := calls[0]; arg[0] != testUser.ID || !arg[1].(time.Time).Equal(before) {
+		t.Errorf("RevokeUserSessionsBefore(%v, %v), want (%d, %s)", arg[0], arg[1], testUser.ID, before)
+	}
+}
+
+func TestRevokedLoginSessionRejectsToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		revokedAt pgtype.Timestamptz
+		err       error
+		want      int
+	}{
+		{name: "active", want: http.StatusOK},
+		{name: "revoked", revokedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true}, want: http.StatusUnauthorized},
+		{name: "deleted", err: pgx.ErrNoRows, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, db := newTestServer(t)
+			newFakeRevocations(db)
+			db.returns("TouchLoginSession", tt.revokedAt, tt.err)
+
+			expectStatus(t, serve(server, http.MethodGet, "/me", "", accessToken(t, server, testUser, "family")), tt.want)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+const maxSearchQueryLength = 200
+
+// search posts by title and content, best matches first. q uses the web search syntax:
+// "quoted phrases", or, and -excluded words.
+type searchPostsRequest struct {
+	Query    string    `form:"q" binding:"required"`
+	AuthorID int32     `form:"author_id" binding:"omitempty,min=1"`
+	From     time.Time `form:"from" time_format:"2006-01-02" time_utc:"1"`
+	To       time.Time `form:"to" time_format:"2006-01-02" time_utc:"1"` // inclusive
+	Cursor   string    `form:"cursor"`
+	PageSize int32     `form:"page_size" binding:"omitempty,min=5,max=20"`
+}
+
+// searchResult is a post with how well it matched. Headline is a snippet of the content with the
+// matched words wrapped in <mark>, the rest of it is HTML-escaped so it can be rendered as is.
+type searchResult struct {
+	ID        int32     `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	UserID    int32     `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Rank      float32   `json:"rank"`
+	Headline  string    `json:"headline"`
+}
+
+type searchPostsResponse struct {
+	Results    []searchResult `json:"results"`
+	NextCursor string         `json:"next_cursor,omitempty"` // left out on the last page
+}
+
+func (server *Server) searchPosts(c *gin.Context) {
+	var req searchPostsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Query = strings.TrimSpace(req.Query)
+	if req.Query == "" || len(req.Query) > maxSearchQueryLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q must be between 1 and 200 characters"})
+		return
+	}
+	if !req.From.IsZero() && !req.To.IsZero() && req.To.Before(req.From) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return
+	}
+	if req.PageSize == 0 {
+		req.PageSize = defaultPostPageSize
+	}
+
+	// one extra row tells whether there is a next page
+	arg := repo.SearchPostsParams{
+		Query:    req.Query,
+		PageSize: req.PageSize + 1,
+	}
+	if req.AuthorID > 0 {
+		arg.AuthorID = &req.AuthorID
+	}
+	if !req.From.IsZero() {
+		arg.CreatedFrom = pgtype.Timestamptz{Time: req.From, Valid: true}
+	}
+	if !req.To.IsZero() {
+		arg.CreatedTo = pgtype.Timestamptz{Time: req.To.AddDate(0, 0, 1), Valid: true}
+	}
+	if req.Cursor != "" {
+		cursor, err := decodeSearchCursor(req.Cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		arg.AfterRank = &cursor.Rank
+		arg.AfterID = &cursor.ID
+	}
+
+	rows, err := server.store.SearchPosts(c, arg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search posts"})
+		return
+	}
+
+	rsp := searchPostsResponse{Results: make([]searchResult, 0, len(rows))}
+	if len(rows) > int(req.PageSize) {
+		rows = rows[:req.PageSize]
+		last := rows[len(rows)-1]
+		rsp.NextCursor = searchCursor{Rank: last.Rank, ID: last.ID}.encode()
+	}
+	for _, row := range rows {
+		rsp.Results = append(rsp.Results, searchResult{
+			ID:        row.ID,
+			Title:     row.Title,
+			Content:   row.Content,
+			UserID:    row.UserID,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			Rank:      row.Rank,
+			Headline:  row.Headline,
+		})
+	}
+	c.JSON(http.StatusOK, rsp)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+// newSearchServer returns a server whose search matches count posts, ranked by decreasing id,
+// and an access token for testUser.
+func newSearchServer(t *testing.T, count int) (*Server, *fakeDB, string) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	db.on("SearchPosts", func(args ...interface{}) (interface{}, error) {
+		afterID, pageSize := args[5].(*int32), args[6].(int32)
+		rows := []repo.SearchPostsRow{}
+		for id := int32(count); id > 0 && len(rows) < int(pageSize); id-- {
+			if afterID != nil && id >= *afterID {
+				continue
+			}
+			rows = append(rows, repo.SearchPostsRow{ID: id, Title: "Go", Content: "Learning Go", UserID: testUser.ID, Rank: float32(id) / 100, Headline: "Learning <mark>Go</mark>"})
+		}
+		return rows, nil
+	})
+	return server, db, accessToken(t, server, testUser, "family")
+}
+
+func search(t *testing.T, server *Server, token string, query url.Values) searchPostsResponse {
+	t.Helper()
+	rec := serve(server, http.MethodGet, "/posts/search?"+query.Encode(), "", token)
+	expectStatus(t, rec, http.StatusOK)
+	var rsp searchPostsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &rsp); err != nil {
+		t.Fatal(err)
+	}
+	return rsp
+}
+
+func TestSearchPosts(t *testing.T) {
+	server, db, token := newSearchServer(t, 3)
+
+	rsp := search(t, server, token, url.Values{"q": {"  go  "}})
+	if len(rsp.Results) != 3 || rsp.Results[0].ID != 3 || rsp.Results[0].Headline != "Learning <mark>Go</mark>" || rsp.Results[0].Rank != 0.03 {
+		t.Errorf("results = %+v", rsp.Results)
+	}
+	if rsp.NextCursor != "" {
+		t.Errorf("next cursor = %q on the last page", rsp.NextCursor)
+	}
+
+	searched := db.called("SearchPosts")
+	if len(searched) != 1 || searched[0][0] != "go" || searched[0][6] != int32(defaultPostPageSize+1) {
+		t.Fatalf("SearchPosts calls = %v, want the trimmed query and one extra row", searched)
+	}
+	// no filters and no cursor
+	if searched[0][1].(*int32) != nil || searched[0][2].(pgtype.Timestamptz).Valid || searched[0][3].(pgtype.Timestamptz).Valid || searched[0][4].(*float32) != nil {
+		t.Errorf("SearchPosts call = %v, want no filters", searched[0])
+	}
+}
+
+func TestSearchPostsFilters(t *testing.T) {
+	server, db, token := newSearchServer(t, 3)
+
+	search(t, server, token, url.Values{"q": {"go"}, "author_id": {"7"}, "from": {"2025-01-01"}, "to": {"2025-01-31"}})
+
+	searched := db.called("SearchPosts")
+	if len(searched) != 1 {
+		t.Fatalf("SearchPosts calls = %v", searched)
+	}
+	if author := searched[0][1].(*int32); author == nil || *author != 7 {
+		t.Errorf("author = %v, want 7", author)
+	}
+	if from := searched[0][2].(pgtype.Timestamptz); !from.Time.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("created from %s, want the start of the first day", from.Time)
+	}
+	// to is inclusive, the whole last day is searched
+	if to := searched[0][3].(pgtype.Timestamptz); !to.Time.Equal(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("created before %s, want the end of the last day", to.Time)
+	}
+}
+
+func TestSearchPostsPages(t *testing.T) {
+	server, db, token := newSearchServer(t, 12)
+
+	var ids []int32
+	query := url.Values{"q": {"go"}, "page_size": {"5"}}
+	for page := 1; ; page++ {
+		rsp := search(t, server, token, query)
+		for _, result := range rsp.Results {
+			ids = append(ids, result.ID)
+		}
+		if rsp.NextCursor == "" {
+			break
+		}
+		if page == 3 {
+			t.Fatal("more than 3 pages for 12 results")
+		}
+		query.Set("cursor", rsp.NextCursor)
+	}
+
+	if len(ids) != 12 || ids[0] != 12 || ids[11] != 1 {
+		t.Errorf("ids = %v, want each of the 12 results once, best first", ids)
+	}
+	// the cursor carries the exact rank and id of the last result
+	searched := db.called("SearchPosts")
+	if rank, id := searched[1][4].(*float32), searched[1][5].(*int32); rank == nil || *rank != float32(8)/100 || id == nil || *id != 8 {
+		t.Errorf("second page after (%v, %v), want (0.08, 8)", rank, id)
+	}
+}
+
+func TestSearchPostsRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		query url.Values
+	}{
+		{name: "no query", query: url.Values{}},
+		{name: "blank query", query: url.Values{"q": {"   "}}},
+		{name: "long query", query: url.Values{"q": {strings.Repeat("go ", 100)}}},
+		{name: "to before from", query: url.Values{"q": {"go"}, "from": {"2025-02-01"}, "to": {"2025-01-01"}}},
+		{name: "bad date", query: url.Values{"q": {"go"}, "from": {"01/02/2025"}}},
+		{name: "bad author", query: url.Values{"q": {"go"}, "author_id": {"-1"}}},
+		{name: "page too large", query: url.Values{"q": {"go"}, "page_size": {"50"}}},
+		{name: "bad cursor", query: url.Values{"q": {"go"}, "cursor": {"not-a-cursor"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, db, token := newSearchServer(t, 3)
+
+			expectStatus(t, serve(server, http.MethodGet, "/posts/search?"+tt.query.Encode(), "", token), http.StatusBadRequest)
+			if len(db.called("SearchPosts")) != 0 {
+				t.Error("the search ran")
+			}
+		})
+	}
+}
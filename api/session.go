@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+const maxUserAgentLength = 255
+
+// startLoginSession records a new login from the calling device and returns its id, which is
+// also the family id of its refresh tokens and the sid claim of its access tokens.
+func (server *Server) startLoginSession(c *gin.Context, user repo.User) (string, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	err = server.store.CreateLoginSession(c, repo.CreateLoginSessionParams{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		UserAgent: userAgent,
+		IpAddress: c.ClientIP(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return familyID, nil
+}
+
+type sessionResponse struct {
+	ID         int32     `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"` // the session the request was made with
+}
+
+// list the devices the caller is logged in on
+func (server *Server) listSessions(c *gin.Context) {
+	claims := authClaims(c)
+	sessions, err := server.store.ListActiveLoginSessions(c, claims.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve sessions"})
+		return
+	}
+
+	rsp := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		rsp = append(rsp, sessionResponse{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IpAddress,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			Current:    session.FamilyID == claims.SessionID,
+		})
+	}
+	c.JSON(http.StatusOK, rsp)
+}
+
+// log one device out, its refresh token stops working and so do its access tokens
+type sessionIDRequest struct {
+	ID int32 `uri:"id" binding:"required,min=1"`
+}
+
+func (server *Server) revokeSession(c *gin.Context) {
+	var uri sessionIDRequest
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	familyID, err := server.store.RevokeLoginSession(c, repo.RevokeLoginSessionParams{
+		ID:     uri.ID,
+		UserID: authClaims(c).ID,
+	})
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+
+	if err := server.store.RevokeSessionFamily(c, familyID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+	server.revocations.revokeSession(familyID, time.Now().Add(server.AccessTokenDuration))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
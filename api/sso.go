@@ -0,0 +1,236 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+	"github.com/Iknite-Space/sqlc-example-api/oidc"
+)
+
+const (
+	oidcAuthRequestTTL = 10 * time.Minute
+	// the state also goes in a cookie so a callback link cannot be replayed in someone else's browser
+	oidcStateCookie = "oidc_state"
+)
+
+var (
+	ErrSSOEmailNotVerified = errors.New("the identity provider did not confirm the email address")
+	// whoever signed up with the address may not own it, the provider's proof is not enough to hand them over the account
+	ErrSSOAccountNotVerified = errors.New("an account with this email exists but its address is not verified, verify it before using single sign-on")
+)
+
+// oidc login, sends the browser to the identity provider
+func (server *Server) oidcLogin(c *gin.Context) {
+	state, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	nonce, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	// abandoned logins are cleaned up as new ones start
+	if err := server.store.DeleteExpiredOIDCAuthRequests(c); err != nil {
+		_ = c.Error(err)
+	}
+	err = server.store.CreateOIDCAuthRequest(c, repo.CreateOIDCAuthRequestParams{
+		StateHash:    hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcAuthRequestTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(oidcAuthRequestTTL.Seconds()), "/oidc", "", server.secureCookies(), true)
+	c.Redirect(http.StatusFound, server.OIDC.AuthCodeURL(state, nonce, challenge))
+}
+
+// oidc callback, the provider sends the browser back here with a code
+type oidcCallbackRequest struct {
+	Code             string `form:"code"`
+	State            string `form:"state" binding:"required"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
+
+func (server *Server) oidcCallback(c *gin.Context) {
+	var req oidcCallbackRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cookie, _ := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, "/oidc", "", server.secureCookies(), true)
+	if subtle.ConstantTimeCompare([]byte(cookie), []byte(req.State)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login was started in another browser"})
+		return
+	}
+
+	// the request is deleted as it is read, a state works once
+	authRequest, err := server.store.TakeOIDCAuthRequest(c, hashToken(req.State))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired login request"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	if req.Error != "" || req.Code == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": strings.TrimSpace("single sign-on was refused: " + req.Error + " " + req.ErrorDescription)})
+		return
+	}
+
+	claims, err := server.OIDC.Exchange(c, req.Code, authRequest.CodeVerifier, authRequest.Nonce)
+	if err != nil {
+		_ = c.Error(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "single sign-on failed"})
+		return
+	}
+
+	user, err := server.ssoUser(c, claims)
+	if err != nil {
+		if errors.Is(err, ErrSignupNotAllowed) || errors.Is(err, ErrSSOEmailNotVerified) || errors.Is(err, ErrSSOAccountNotVerified) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	// the provider is trusted with second factors, a local TOTP is only asked for password logins
+	server.completeLogin(c, user)
+}
+
+// ssoUser returns the account linked to the external identity. An identity seen for the first time is
+// linked to the account with the same verified email, or gets a new account, as long as the provider
+// verified the email and its domain is allowed to sign up.
+func (server *Server) ssoUser(c *gin.Context, claims *oidc.IDTokenClaims) (repo.User, error) {
+	email := normalizeEmail(claims.Email)
+
+	identity, err := server.store.GetUserIdentity(c, repo.GetUserIdentityParams{
+		Issuer:  server.OIDC.Issuer(),
+		Subject: claims.Subject,
+	})
+	if err == nil {
+		if err := server.store.TouchUserIdentity(c, repo.TouchUserIdentityParams{ID: identity.ID, Email: email}); err != nil {
+			_ = c.Error(err)
+		}
+		return server.store.GetUser(c, identity.UserID)
+	}
+	if err != pgx.ErrNoRows {
+		return repo.User{}, err
+	}
+
+	if email == "" || !claims.EmailVerified {
+		return repo.User{}, ErrSSOEmailNotVerified
+	}
+	if !server.emailDomainAllowed(email) {
+		return repo.User{}, ErrSignupNotAllowed
+	}
+
+	user, err := server.store.GetUseryByEmail(c, email)
+	switch {
+	case err == pgx.ErrNoRows:
+		user, err = server.provisionSSOUser(c, claims, email)
+	case err == nil && !user.VerifiedAt.Valid:
+		err = ErrSSOAccountNotVerified
+	}
+	if err != nil {
+		return repo.User{}, err
+	}
+
+	_, err = server.store.CreateUserIdentity(c, repo.CreateUserIdentityParams{
+		UserID:  user.ID,
+		Issuer:  server.OIDC.Issuer(),
+		Subject: claims.Subject,
+		Email:   email,
+	})
+	if err != nil {
+		return repo.User{}, err
+	}
+	return user, nil
+}
+
+// provisionSSOUser creates the account of someone logging in through the provider for the first time.
+// It has no password, one can be set right after a login or through the forgotten password flow.
+func (server *Server) provisionSSOUser(ctx context.Context, claims *oidc.IDTokenClaims, email string) (repo.User, error) {
+	base := ssoUsername(claims, email)
+
+	var err error
+	for attempt := 0; attempt < 5; attempt++ {
+		username := base
+		if attempt > 0 {
+			username = fmt.Sprintf("%s%d", base, rand.IntN(10000))
+		}
+
+		var user repo.User
+		user, err = server.store.CreateUser(ctx, repo.CreateUserParams{
+			Username: username,
+			Email:    email,
+		})
+		if err == nil {
+			// the provider verified the email already
+			if err := server.store.MarkUserVerified(ctx, user.ID); err != nil {
+				return repo.User{}, err
+			}
+			return server.store.GetUser(ctx, user.ID)
+		}
+		if !isUniqueViolation(err) {
+			return repo.User{}, err
+		}
+	}
+	return repo.User{}, err
+}
+
+// ssoUsername picks a username like signup would accept one: letters and digits only.
+func ssoUsername(claims *oidc.IDTokenClaims, email string) string {
+	candidate := claims.PreferredUsername
+	if at := strings.Index(candidate, "@"); at >= 0 {
+		candidate = candidate[:at]
+	}
+	if candidate == "" {
+		candidate, _, _ = strings.Cut(email, "@")
+	}
+
+	username := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return -1
+	}, candidate)
+	if username == "" {
+		return "user"
+	}
+	return username
+}
+
+// secureCookies is on whenever the app is served over https.
+func (server *Server) secureCookies() bool {
+	return strings.HasPrefix(server.BaseURL, "https://")
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+	"github.com/Iknite-Space/sqlc-example-api/oidc"
+	"github.com/Iknite-Space/sqlc-example-api/oidc/oidctest"
+)
+
+// newSSOServer returns a server logging in through a provider running in the test. Jane is who logs
+// in at the provider, the test decides which account she has here.
+func newSSOServer(t *testing.T) (*Server, *fakeDB, *oidctest.Provider) {
+	idp := oidctest.NewProvider("app", "secret")
+	t.Cleanup(idp.Close)
+	idp.Claims["sub"] = "248289761001"
+	idp.Claims["email"] = "Jane@Example.com"
+	idp.Claims["email_verified"] = true
+	idp.Claims["preferred_username"] = "jane.doe"
+
+	server, db := newTestServer(t)
+	server.AllowedEmailDomains = []string{"example.com"}
+	provider, err := oidc.Discover(context.Background(), oidc.Config{
+		IssuerURL:    idp.URL,
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  "http://example.com/oidc/callback",
+	}, idp.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.OIDC = provider
+
+	var mu sync.Mutex
+	authRequests := make(map[string]repo.OIDCAuthRequest)
+	db.returns("DeleteExpiredOIDCAuthRequests", nil, nil)
+	db.on("CreateOIDCAuthRequest", func(args ...interface{}) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		authRequests[args[0].(string)] = repo.OIDCAuthRequest{
+			StateHash:    args[0].(string),
+			Nonce:        args[1].(string),
+			CodeVerifier: args[2].(string),
+			ExpiresAt:    args[3].(time.Time),
+		}
+		return nil, nil
+	})
+	db.on("TakeOIDCAuthRequest", func(args ...interface{}) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		authRequest, ok := authRequests[args[0].(string)]
+		if !ok {
+			return nil, pgx.ErrNoRows
+		}
+		delete(authRequests, args[0].(string))
+		return authRequest, nil
+	})
+	db.returns("CreateLoginSession", repo.LoginSession{}, nil)
+	db.returns("CreateSession", repo.Session{}, nil)
+	return server, db, idp
+}
+
+// ssoLogin goes through the login like a browser would and returns the callback request,
+// with the state cookie set by the login.
+func ssoLogin(t *testing.T, server *Server, idp *oidctest.Provider) *http.Request {
+	t.Helper()
+	rec := serve(server, http.MethodGet, "/oidc/login", "", "")
+	expectStatus(t, rec, http.StatusFound)
+
+	client := idp.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("provider answered %s", resp.Status)
+	}
+
+	callback := httptest.NewRequest(http.MethodGet, resp.Header.Get("Location"), nil)
+	for _, cookie := range rec.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+	return callback
+}
+
+func serveRequest(server *Server, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	server.WireHttpHandler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSSOProvisionsNewUser(t *testing.T) {
+	server, db, idp := newSSOServer(t)
+	jane := repo.User{ID: 9, Username: "janedoe", Email: "jane@example.com", Role: RoleMember}
+	db.returns("GetUserIdentity", nil, pgx.ErrNoRows)
+	db.returns("GetUseryByEmail", nil, pgx.ErrNoRows)
+	db.returns("CreateUser", jane, nil)
+	db.returns("MarkUserVerified", nil, nil)
+	jane.VerifiedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	db.returns("GetUser", jane, nil)
+	db.returns("CreateUserIdentity", repo.UserIdentity{}, nil)
+
+	rec := serveRequest(server, ssoLogin(t, server, idp))
+	expectStatus(t, rec, http.StatusOK)
+
+	created := db.called("CreateUser")
+	if len(created) != 1 || created[0][0] != "janedoe" || created[0][1] != "jane@example.com" || created[0][2] != "" {
+		t.Fatalf("CreateUser calls = %v, want janedoe without a password", created)
+	}
+	if verified := db.called("MarkUserVerified"); len(verified) != 1 || verified[0][0] != jane.ID {
+		t.Errorf("MarkUserVerified calls = %v, want the new account", verified)
+	}
+	linked := db.called("CreateUserIdentity")
+	if len(linked) != 1 || linked[0][0] != jane.ID || linked[0][1] != idp.URL || linked[0][2] != "248289761001" {
+		t.Errorf("CreateUserIdentity calls = %v, want the new account linked to the provider's subject", linked)
+	}
+}
+
+func TestSSOLinksAccountWithSameEmail(t *testing.T) {
+	server, db, idp := newSSOServer(t)
+	idp.Claims["email"] = testUser.Email
+	db.returns("GetUserIdentity", nil, pgx.ErrNoRows)
+	db.returns("GetUseryByEmail", verifiedUser, nil)
+	db.returns("CreateUserIdentity", repo.UserIdentity{}, nil)
+
+	rec := serveRequest(server, ssoLogin(t, server, idp))
+	expectStatus(t, rec, http.StatusOK)
+
+	if linked := db.called("CreateUserIdentity"); len(linked) != 1 || linked[0][0] != testUser.ID {
+		t.Errorf("CreateUserIdentity calls = %v, want the existing account linked", linked)
+	}
+}
+
+func TestSSORefusesUnverifiedAccountWithSameEmail(t *testing.T) {
+	server, db, idp := newSSOServer(t)
+	idp.Claims["email"] = testUser.Email
+	db.returns("GetUserIdentity", nil, pgx.ErrNoRows)
+	db.returns("GetUseryByEmail", testUser, nil)
+
+	// someone may have signed up with the address before its owner, they must not get the owner's identity
+	rec := serveRequest(server, ssoLogin(t, server, idp))
+	expectStatus(t, rec, http.StatusForbidden)
+
+	if len(db.called("CreateUserIdentity")) != 0 || len(db.called("CreateSession")) != 0 {
+		t.Error("the identity was linked to an unverified account")
+	}
+}
+
+func TestSSOKnownIdentity(t *testing.T) {
+	server, db, idp := newSSOServer(t)
+	db.returns("GetUserIdentity", repo.UserIdentity{ID: 3, UserID: testUser.ID, Issuer: idp.URL, Subject: "248289761001"}, nil)
+	db.returns("TouchUserIdentity", nil, nil)
+	db.returns("GetUser", testUser, nil)
+
+	rec := serveRequest(server, ssoLogin(t, server, idp))
+	expectStatus(t, rec, http.StatusOK)
+
+	// the account is found by the subject, the email the provider sends now only updates the link
+	if lookups := db.called("GetUserIdentity"); len(lookups) != 1 || lookups[0][0] != idp.URL || lookups[0][1] != "248289761001" {
+		t.Errorf("GetUserIdentity calls = %v", lookups)
+	}
+	if touched := db.called("TouchUserIdentity"); len(touched) != 1 || touched[0][1] != "jane@example.com" {
+		t.Errorf("TouchUserIdentity calls = %v", touched)
+	}
+}
+
+func TestSSORefusesNewIdentity(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+	}{
+		// anyone can claim any email at some providers, an unverified one must not take over an account
+		{name: "unverified email", claims: map[string]interface{}{"email_verified": false}},
+		{name: "no email", claims: map[string]interface{}{"email": ""}},
+		{name: "other domain", claims: map[string]interface{}{"email": "jane@elsewhere.org"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, db, idp := newSSOServer(t)
+			for name, value := range tt.claims {
+				idp.Claims[name] = value
+			}
+			db.returns("GetUserIdentity", nil, pgx.ErrNoRows)
+
+			rec := serveRequest(server, ssoLogin(t, server, idp))
+			expectStatus(t, rec, http.StatusForbidden)
+			if len(db.called("GetUseryByEmail")) != 0 || len(db.called("CreateUserIdentity")) != 0 {
+				t.Error("the identity was linked to an account")
+			}
+		})
+	}
+}
+
+func TestSSOCallbackRejects(t *testing.T) {
+	t.Run("state of another browser", func(t *testing.T) {
+		server, _, idp := newSSOServer(t)
+		callback := ssoLogin(t, server, idp)
+		callback.Header.Del("Cookie")
+
+		expectStatus(t, serveRequest(server, callback), http.StatusBadRequest)
+	})
+
+	t.Run("replayed callback", func(t *testing.T) {
+		server, db, idp := newSSOServer(t)
+		db.returns("GetUserIdentity", repo.UserIdentity{UserID: testUser.ID}, nil)
+		db.returns("TouchUserIdentity", nil, nil)
+		db.returns("GetUser", testUser, nil)
+		callback := ssoLogin(t, server, idp)
+
+		expectStatus(t, serveRequest(server, callback), http.StatusOK)
+		expectStatus(t, serveRequest(server, callback.Clone(context.Background())), http.StatusBadRequest)
+	})
+
+	t.Run("id token for another client", func(t *testing.T) {
+		server, db, idp := newSSOServer(t)
+		idp.Claims["aud"] = "another-app"
+
+		expectStatus(t, serveRequest(server, ssoLogin(t, server, idp)), http.StatusUnauthorized)
+		if len(db.called("GetUserIdentity")) != 0 {
+			t.Error("the claims of an invalid id token were used")
+		}
+	})
+}
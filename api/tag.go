@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxPostTags = 10
+
+var (
+	ErrInvalidTag  = errors.New("tags are 1 to 30 letters, digits or dashes")
+	ErrTooManyTags = errors.New("a post has at most 10 tags")
+)
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9-]{1,30}$`)
+
+// normalizeTag returns the tag the way post_tags stores it: trimmed and lowercase.
+func normalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if !tagPattern.MatchString(tag) {
+		return "", ErrInvalidTag
+	}
+	return tag, nil
+}
+
+// normalizeTags normalizes every tag and drops the ones given twice. A nil slice stays nil, the
+// update handler reads it as "leave the tags alone".
+func normalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag, err := normalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxPostTags {
+		return nil, ErrTooManyTags
+	}
+	return normalized, nil
+}
+
+// postTags returns the tags of each post, posts without tags are left out.
+func (server *Server) postTags(c *gin.Context, postIDs []int32) (map[int32][]string, error) {
+	tags := make(map[int32][]string, len(postIDs))
+	if len(postIDs) == 0 {
+		return tags, nil
+	}
+
+	rows, err := server.store.ListPostTags(c, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		tags[row.PostID] = append(tags[row.PostID], row.Tag)
+	}
+	return tags, nil
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		tags []string
+		want []string
+		err  error
+	}{
+		{tags: nil, want: nil},
+		{tags: []string{}, want: []string{}},
+		{tags: []string{" Go ", "GO", "web-dev"}, want: []string{"go", "web-dev"}},
+		{tags: []string{""}, err: ErrInvalidTag},
+		{tags: []string{"two words"}, err: ErrInvalidTag},
+		{tags: []string{"ünïcode"}, err: ErrInvalidTag},
+		{tags: []string{"a123456789012345678901234567890"}, err: ErrInvalidTag},
+	}
+	for _, tt := range tests {
+		got, err := normalizeTags(tt.tags)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("normalizeTags(%q) error = %v, want %v", tt.tags, err, tt.err)
+			continue
+		}
+		if tt.err == nil && (!reflect.DeepEqual(got, tt.want) || (got == nil) != (tt.want == nil)) {
+			t.Errorf("normalizeTags(%q) = %q, want %q", tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeTagsLimit(t *testing.T) {
+	tags := make([]string, 0, maxPostTags+1)
+	for i := 0; i <= maxPostTags; i++ {
+		tags = append(tags, fmt.Sprint("tag", i))
+	}
+	if _, err := normalizeTags(tags); !errors.Is(err, ErrTooManyTags) {
+		t.Errorf("err = %v, want ErrTooManyTags", err)
+	}
+	// duplicates do not count against the limit
+	if _, err := normalizeTags(append(tags[:maxPostTags], "TAG0")); err != nil {
+		t.Errorf("err = %v, want nil", err)
+	}
+}
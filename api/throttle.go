@@ -0,0 +1,162 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+const (
+	defaultMaxLoginFailures      = 10
+	defaultMaxLoginFailuresPerIP = 50
+	defaultLoginLockoutDuration  = 15 * time.Minute
+
+	// failures older than loginFailureWindow are forgotten
+	loginFailureWindow = time.Hour
+	// the first few mistakes are free, after that every failure doubles the wait up to maxLoginDelay
+	freeLoginFailures = 3
+	maxLoginDelay     = 30 * time.Second
+)
+
+func accountThrottleKey(account string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginDelay is how long a client has to wait after its latest failure before trying again.
+func loginDelay(failures int32) time.Duration {
+	if failures <= freeLoginFailures {
+		return 0
+	}
+	exp := float64(failures - freeLoginFailures - 1)
+	delay := time.Duration(math.Pow(2, exp)) * time.Second
+	if delay <= 0 || delay > maxLoginDelay {
+		return maxLoginDelay
+	}
+	return delay
+}
+
+// loginRetryAfter returns how long the key must wait before its next attempt, zero when it can try now.
+func (server *Server) loginRetryAfter(c *gin.Context, key string, now time.Time) (time.Duration, error) {
+	throttle, err := server.store.GetLoginThrottle(c, key)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if throttle.LockedUntil.Valid && now.Before(throttle.LockedUntil.Time) {
+		return throttle.LockedUntil.Time.Sub(now), nil
+	}
+	if now.Sub(throttle.LastFailureAt) > loginFailureWindow {
+		return 0, nil
+	}
+
+	return time.Until(throttle.LastFailureAt.Add(loginDelay(throttle.Failures))), nil
+}
+
+// checkLoginThrottle answers 429 and returns false when the account or the client IP has to wait.
+// account is the email of the account, or the identifier as typed when there is no such account,
+// so unknown and existing accounts are throttled the same way.
+func (server *Server) checkLoginThrottle(c *gin.Context, account string) bool {
+	now := time.Now()
+
+	var wait time.Duration
+	for _, key := range []string{accountThrottleKey(account), ipThrottleKey(c.ClientIP())} {
+		retryAfter, err := server.loginRetryAfter(c, key, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return false
+		}
+		wait = max(wait, retryAfter)
+	}
+
+	if wait > 0 {
+		c.Header("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed login attempts, try again later"})
+		return false
+	}
+	return true
+}
+
+// loginFailed counts the failure for the account and the client IP and answers 401.
+func (server *Server) loginFailed(c *gin.Context, account string) {
+	server.recordLoginFailures(c, account)
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+}
+
+// recordLoginFailures counts a wrong password or second factor for the account and the client IP.
+func (server *Server) recordLoginFailures(c *gin.Context, account string) {
+	if err := server.recordLoginFailure(c, accountThrottleKey(account), server.MaxLoginFailures); err != nil {
+		_ = c.Error(err)
+	}
+	if err := server.recordLoginFailure(c, ipThrottleKey(c.ClientIP()), server.MaxLoginFailuresPerIP); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// loginSucceeded forgets the account's failures once every factor was checked.
+func (server *Server) loginSucceeded(c *gin.Context, account string) {
+	if err := server.store.DeleteLoginThrottle(c, accountThrottleKey(account)); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// recordLoginFailure counts one failure for the key and locks it once it reaches limit.
+func (server *Server) recordLoginFailure(c *gin.Context, key string, limit int32) error {
+	now := time.Now()
+
+	throttle, err := server.store.RecordLoginFailure(c, repo.RecordLoginFailureParams{
+		Key:         key,
+		WindowStart: now.Add(-loginFailureWindow),
+	})
+	if err != nil {
+		return err
+	}
+
+	if throttle.Failures < limit {
+		return nil
+	}
+	return server.store.LockLoginThrottle(c, repo.LockLoginThrottleParams{
+		Key:         key,
+		LockedUntil: pgtype.Timestamptz{Time: now.Add(server.LoginLockoutDuration), Valid: true},
+	})
+}
+
+// unlock an account locked by failed logins, for admins
+func (server *Server) unlockUser(c *gin.Context) {
+	var uri userIDRequest
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := server.store.GetUser(c, uri.ID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	if err := server.store.DeleteLoginThrottle(c, accountThrottleKey(user.Email)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+func TestLoginDelay(t *testing.T) {
+	tests := []struct {
+		failures int32
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: freeLoginFailures, want: 0},
+		{failures: freeLoginFailures + 1, want: time.Second},
+		{failures: freeLoginFailures + 2, want: 2 * time.Second},
+		{failures: freeLoginFailures + 4, want: 8 * time.Second},
+		{failures: freeLoginFailures + 10, want: maxLoginDelay},
+		{failures: 1000, want: maxLoginDelay},
+	}
+	for _, tt := range tests {
+		if got := loginDelay(tt.failures); got != tt.want {
+			t.Errorf("loginDelay(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+// newLoginServer returns a server where testUser logs in with "correct horse".
+func newLoginServer(t *testing.T) (*Server, *fakeDB, *fakeThrottles) {
+	server, db := newTestServer(t)
+	server.PasswordHasher = BcryptHasher{Cost: bcrypt.MinCost}
+
+	hash, err := server.PasswordHasher.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := verifiedUser
+	user.HashedPassword = hash
+	db.returns("GetUseryByEmail", user, nil)
+	db.returns("GetUserByUsername", user, nil)
+	db.returns("GetTOTPCredential", nil, pgx.ErrNoRows)
+	db.returns("CreateLoginSession", repo.LoginSession{}, nil)
+	db.returns("CreateSession", repo.Session{}, nil)
+	return server, db, newFakeThrottles(db)
+}
+
+func login(server *Server, identifier string, password string) (int, string) {
+	body := `{"identifier": "` + identifier + `", "password": "` + password + `"}`
+	rec := serve(server, http.MethodPost, "/login", body, "")
+	return rec.Code, rec.Header().Get("Retry-After")
+}
+
+func TestLoginThrottleDelaysRepeatedFailures(t *testing.T) {
+	server, _, _ := newLoginServer(t)
+
+	for i := 0; i <= freeLoginFailures; i++ {
+		if status, _ := login(server, testUser.Email, "wrong"); status != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status = %d, want 401", i+1, status)
+		}
+	}
+
+	// the right password has to wait like any other attempt
+	status, retryAfter := login(server, testUser.Email, "correct horse")
+	if status != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", status)
+	}
+	if retryAfter != "1" {
+		t.Errorf("Retry-After = %q, want 1", retryAfter)
+	}
+}
+
+func TestLoginThrottleLocksAccount(t *testing.T) {
+	server, _, throttles := newLoginServer(t)
+	server.MaxLoginFailures = 2
+
+	for i := 0; i < 2; i++ {
+		if status, _ := login(server, testUser.Email, "wrong"); status != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status = %d, want 401", i+1, status)
+		}
+	}
+
+	row, _ := throttles.get(accountThrottleKey(testUser.Email))
+	if !row.LockedUntil.Valid {
+		t.Fatal("the account was not locked")
+	}
+	status, retryAfter := login(server, testUser.Email, "correct horse")
+	if status != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", status)
+	}
+	if seconds, _ := strconv.Atoi(retryAfter); seconds < int(server.LoginLockoutDuration.Seconds())-1 {
+		t.Errorf("Retry-After = %q, want the lockout duration", retryAfter)
+	}
+
+	// the username of the same account is throttled with it
+	if status, _ := login(server, testUser.Username, "correct horse"); status != http.StatusTooManyRequests {
+		t.Errorf("login by username: status = %d, want 429", status)
+	}
+}
+
+func TestLoginThrottleCountsUnknownAccountsPerIP(t *testing.T) {
+	server, db, throttles := newLoginServer(t)
+	server.MaxLoginFailuresPerIP = 3
+	db.returns("GetUseryByEmail", nil, pgx.ErrNoRows)
+
+	for i := 0; i < 3; i++ {
+		if status, _ := login(server, "nobody"+strconv.Itoa(i)+"@example.com", "guess"); status != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want 401", i+1, status)
+		}
+	}
+
+	row, _ := throttles.get(ipThrottleKey("192.0.2.1"))
+	if row.Failures != 3 || !row.LockedUntil.Valid {
+		t.Fatalf("ip throttle = %+v, want 3 failures and a lock", row)
+	}
+	if status, _ := login(server, "someone-else@example.com", "guess"); status != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", status)
+	}
+}
+
+func TestLoginThrottleForgetsOldFailures(t *testing.T) {
+	server, _, throttles := newLoginServer(t)
+	throttles.rows[accountThrottleKey(testUser.Email)] = repo.LoginThrottle{
+		Key:           accountThrottleKey(testUser.Email),
+		Failures:      freeLoginFailures + 5,
+		LastFailureAt: time.Now().Add(-loginFailureWindow - time.Minute),
+	}
+
+	if status, _ := login(server, testUser.Email, "correct horse"); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+}
+
+func TestLoginSuccessResetsAccountOnly(t *testing.T) {
+	server, _, throttles := newLoginServer(t)
+
+	if status, _ := login(server, testUser.Email, "wrong"); status != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", status)
+	}
+	if status, _ := login(server, testUser.Email, "correct horse"); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+
+	if _, ok := throttles.get(accountThrottleKey(testUser.Email)); ok {
+		t.Error("the account failures were kept after a successful login")
+	}
+	// a client guessing many accounts cannot reset its IP counter with one account it owns
+	if row, ok := throttles.get(ipThrottleKey("192.0.2.1")); !ok || row.Failures != 1 {
+		t.Errorf("ip throttle = %+v, want the failure kept", row)
+	}
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+const (
+	defaultAccessTokenDuration  = 15 * time.Minute
+	defaultRefreshTokenDuration = 30 * 24 * time.Hour
+)
+
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// randomToken returns n random bytes encoded so they can be sent in a URL or JSON body.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the value we store for an opaque token, the raw token never reaches the database.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenPair is what login and refresh hand back to the client.
+type tokenPair struct {
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+}
+
+// issueTokens creates a new session in the given token family with q and signs an access token for it.
+func (server *Server) issueTokens(c *gin.Context, q *repo.Queries, user repo.User, familyID string) (tokenPair, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	refreshExpiresAt := time.Now().Add(server.RefreshTokenDuration)
+	_, err = q.CreateSession(c, repo.CreateSessionParams{
+		UserID:           user.ID,
+		FamilyID:         familyID,
+		RefreshTokenHash: hashToken(refreshToken),
+		ExpiresAt:        refreshExpiresAt,
+	})
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	accessExpiresAt := time.Now().Add(server.AccessTokenDuration)
+	accessToken, err := server.generateToken(user.ID, user.Username, user.Role, familyID, server.AccessTokenDuration)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	return tokenPair{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessExpiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// refresh token rotation
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+func (server *Server) refreshToken(c *gin.Context) {
+	var req refreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := server.store.GetSessionByTokenHash(c, hashToken(req.RefreshToken))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	// a refresh token that was already rotated or revoked is being replayed,
+	// so we assume it was stolen and end the login session it belongs to
+	if session.RevokedAt.Valid {
+		server.refreshTokenReused(c, session.FamilyID)
+		return
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token expired"})
+		return
+	}
+
+	// rotate: the old token can only be used once, a concurrent refresh that loses the race counts as reuse.
+	// the new session is only created when the old one is revoked
+	var tokens tokenPair
+	err = server.inTx(c, func(q *repo.Queries) error {
+		rows, err := q.RevokeSession(c, session.ID)
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrRefreshTokenReused
+		}
+		user, err := q.GetUser(c, session.UserID)
+		if err != nil {
+			return err
+		}
+		if server.emailVerificationRequired(user) {
+			return ErrEmailNotVerified
+		}
+		tokens, err = server.issueTokens(c, q, user, session.FamilyID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			server.refreshTokenReused(c, session.FamilyID)
+			return
+		}
+		if errors.Is(err, ErrEmailNotVerified) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// refreshTokenReused revokes every refresh token of the family and its login session, so the
+// access tokens issued in it stop working as well, and refuses the refresh.
+func (server *Server) refreshTokenReused(c *gin.Context, familyID string) {
+	err := server.inTx(c, func(q *repo.Queries) error {
+		if err := q.RevokeSessionFamily(c, familyID); err != nil {
+			return err
+		}
+		return q.RevokeLoginSessionByFamily(c, familyID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	server.revocations.revokeSession(familyID, time.Now().Add(server.AccessTokenDuration))
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": ErrRefreshTokenReused.Error()})
+}
+
+// logout revokes the access token used for the request and, if given, the refresh token family with it
+type logoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (server *Server) logout(c *gin.Context) {
+	var req logoutRequest
+	// the body is optional, a bare POST only revokes the access token
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	claims := authClaims(c)
+	if err := server.revocations.revoke(c, claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke token"})
+		return
+	}
+
+	if req.RefreshToken != "" {
+		session, err := server.store.GetSessionByTokenHash(c, hashToken(req.RefreshToken))
+		if err != nil && err != pgx.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+		// someone else's refresh token is silently ignored
+		if err == nil && session.UserID == claims.ID {
+			if err := server.store.RevokeSessionFamily(c, session.FamilyID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+				return
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// logout from all devices
+type logoutAllRequest struct {
+	Before *time.Time `json:"before"`
+}
+
+func (server *Server) logoutAll(c *gin.Context) {
+	var req logoutAllRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// by default every token issued up to now is invalidated
+	before := time.Now()
+	if req.Before != nil {
+		if req.Before.After(before) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before cannot be in the future"})
+			return
+		}
+		before = *req.Before
+	}
+
+	claims := authClaims(c)
+	if err := server.revocations.revokeAllBefore(c, claims.ID, before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+	// refresh tokens issued since then stay valid as well
+	err := server.store.RevokeUserSessionsBefore(c, repo.RevokeUserSessionsBeforeParams{
+		UserID:    claims.ID,
+		CreatedAt: before,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all devices"})
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+// fakeSessions keeps the sessions table of a fakeDB, with the conditions of the session queries.
+type fakeSessions struct {
+	byHash map[string]*repo.Session
+	nextID int32
+}
+
+func newFakeSessions(db *fakeDB) *fakeSessions {
+	sessions := &fakeSessions{byHash: make(map[string]*repo.Session)}
+	db.on("CreateSession", func(args ...interface{}) (interface{}, error) {
+		sessions.nextID++
+		session := &repo.Session{
+			ID:               sessions.nextID,
+			UserID:           args[0].(int32),
+			FamilyID:         args[1].(string),
+			RefreshTokenHash: args[2].(string),
+			ExpiresAt:        args[3].(time.Time),
+			CreatedAt:        time.Now(),
+		}
+		sessions.byHash[session.RefreshTokenHash] = session
+		return *session, nil
+	})
+	db.on("GetSessionByTokenHash", func(args ...interface{}) (interface{}, error) {
+		session, ok := sessions.byHash[args[0].(string)]
+		if !ok {
+			return nil, pgx.ErrNoRows
+		}
+		return *session, nil
+	})
+	db.on("RevokeSession", func(args ...interface{}) (interface{}, error) {
+		for _, session := range sessions.byHash {
+			if session.ID == args[0].(int32) && !session.RevokedAt.Valid {
+				session.RevokedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+				return int64(1), nil
+			}
+		}
+		return int64(0), nil
+	})
+	db.on("RevokeSessionFamily", func(args ...interface{}) (interface{}, error) {
+		for _, session := range sessions.byHash {
+			if session.FamilyID == args[0].(string) && !session.RevokedAt.Valid {
+				session.RevokedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+			}
+		}
+		return nil, nil
+	})
+	return sessions
+}
+
+func refresh(t *testing.T, server *Server, refreshToken string) (*tokenPair, int) {
+	t.Helper()
+	body, _ := json.Marshal(refreshTokenRequest{RefreshToken: refreshToken})
+	rec := serve(server, http.MethodPost, "/token/refresh", string(body), "")
+	if rec.Code != http.StatusOK {
+		return nil, rec.Code
+	}
+	var tokens tokenPair
+	if err := json.Unmarshal(rec.Body.Bytes(), &tokens); err != nil {
+		t.Fatal(err)
+	}
+	return &tokens, rec.Code
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	server, db := newTestServer(t)
+	sessions := newFakeSessions(db)
+	db.returns("GetUser", verifiedUser, nil)
+
+	if _, err := server.store.CreateSession(context.Background(), repo.CreateSessionParams{
+		UserID:           testUser.ID,
+		FamilyID:         "family",
+		RefreshTokenHash: hashToken("first"),
+		ExpiresAt:        time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, status := refresh(t, server, "first")
+	if status != http.StatusOK {
+		t.Fatalf("refresh: status = %d, want 200", status)
+	}
+	if tokens.RefreshToken == "" || tokens.RefreshToken == "first" {
+		t.Fatalf("refresh token was not rotated: %q", tokens.RefreshToken)
+	}
+	next := sessions.byHash[hashToken(tokens.RefreshToken)]
+	if next == nil || next.FamilyID != "family" {
+		t.Fatalf("the new session is not in the old family: %+v", next)
+	}
+	if !sessions.byHash[hashToken("first")].RevokedAt.Valid {
+		t.Error("the used refresh token is still valid")
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	server, db := newTestServer(t)
+	sessions := newFakeSessions(db)
+	newFakeRevocations(db)
+	db.returns("GetUser", verifiedUser, nil)
+	db.returns("RevokeLoginSessionByFamily", nil, nil)
+	access := accessToken(t, server, testUser, "family")
+
+	if _, err := server.store.CreateSession(context.Background(), repo.CreateSessionParams{
+		UserID:           testUser.ID,
+		FamilyID:         "family",
+		RefreshTokenHash: hashToken("stolen"),
+		ExpiresAt:        time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the legitimate client rotates first, the attacker replays the old token afterwards
+	tokens, status := refresh(t, server, "stolen")
+	if status != http.StatusOK {
+		t.Fatalf("refresh: status = %d, want 200", status)
+	}
+	if _, status := refresh(t, server, "stolen"); status != http.StatusUnauthorized {
+		t.Fatalf("replay: status = %d, want 401", status)
+	}
+	if calls := db.called("RevokeSessionFamily"); len(calls) != 1 || calls[0][0] != "family" {
+		t.Fatalf("RevokeSessionFamily calls = %v, want one for the family", calls)
+	}
+
+	// the login session ends too, the access tokens issued in it with it
+	if calls := db.called("RevokeLoginSessionByFamily"); len(calls) != 1 || calls[0][0] != "family" {
+		t.Errorf("RevokeLoginSessionByFamily calls = %v, want one for the family", calls)
+	}
+	expectStatus(t, serve(server, http.MethodGet, "/me", "", access), http.StatusUnauthorized)
+	expectStatus(t, serve(server, http.MethodGet, "/me", "", tokens.AccessToken), http.StatusUnauthorized)
+
+	// the token handed out by the rotation dies with its family
+	if !sessions.byHash[hashToken(tokens.RefreshToken)].RevokedAt.Valid {
+		t.Error("the rotated token survived the reuse")
+	}
+	if _, status := refresh(t, server, tokens.RefreshToken); status != http.StatusUnauthorized {
+		t.Errorf("rotated token after reuse: status = %d, want 401", status)
+	}
+}
+
+func TestRefreshTokenLostRaceCountsAsReuse(t *testing.T) {
+	server, db := newTestServer(t)
+	db.returns("GetSessionByTokenHash", repo.Session{
+		ID:        1,
+		UserID:    testUser.ID,
+		FamilyID:  "family",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}, nil)
+	// a concurrent refresh revoked the session between the read and the update
+	db.returns("RevokeSession", int64(0), nil)
+	db.returns("RevokeSessionFamily", nil, nil)
+	db.returns("RevokeLoginSessionByFamily", nil, nil)
+
+	if _, status := refresh(t, server, "raced"); status != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", status)
+	}
+	if len(db.called("RevokeSessionFamily")) != 1 || len(db.called("RevokeLoginSessionByFamily")) != 1 {
+		t.Error("the family and its login session were not revoked")
+	}
+	// the loser gets no new session
+	if len(db.called("CreateSession")) != 0 {
+		t.Error("a session was created for the lost race")
+	}
+}
+
+func TestRefreshTokenRotationRollsBack(t *testing.T) {
+	server, db := newTestServer(t)
+	db.returns("GetSessionByTokenHash", repo.Session{
+		ID:        1,
+		UserID:    testUser.ID,
+		FamilyID:  "family",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}, nil)
+	db.returns("RevokeSession", int64(1), nil)
+	db.returns("GetUser", verifiedUser, nil)
+	db.returns("CreateSession", nil, errors.New("connection reset"))
+
+	if _, status := refresh(t, server, "token"); status != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", status)
+	}
+	// the old token is only spent when the new session exists, so the client can retry
+	if len(db.called("rollback")) != 1 || len(db.called("commit")) != 0 {
+		t.Error("the revocation of the old session was committed")
+	}
+}
+
+func TestRefreshTokenExpired(t *testing.T) {
+	server, db := newTestServer(t)
+	db.returns("GetSessionByTokenHash", repo.Session{
+		ID:        1,
+		UserID:    testUser.ID,
+		FamilyID:  "family",
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}, nil)
+
+	if _, status := refresh(t, server, "old"); status != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", status)
+	}
+	if len(db.called("RevokeSession")) != 0 {
+		t.Error("an expired token was rotated")
+	}
+}
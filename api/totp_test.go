@@ -0,0 +1,67 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 key of the RFC 6238 test vectors, "12345678901234567890".
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// RFC 6238 appendix B, the last six of its eight digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+
+	for offset := int64(-3); offset <= 3; offset++ {
+		code := totpCode(key, current+offset)
+		step, ok := verifyTOTP(rfc6238Secret, code, now)
+
+		wantOK := offset >= -totpSkew && offset <= totpSkew
+		if ok != wantOK {
+			t.Errorf("code of step now%+d accepted = %v, want %v", offset, ok, wantOK)
+		}
+		if ok && step != current+offset {
+			t.Errorf("code of step now%+d matched step %d", offset, step)
+		}
+	}
+
+	// lowercase secrets and codes typed with a space are accepted
+	code := totpCode(key, current)
+	if _, ok := verifyTOTP("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code[:3]+" "+code[3:], now); !ok {
+		t.Error("formatted code was refused")
+	}
+	if _, ok := verifyTOTP(rfc6238Secret, "12345", now); ok {
+		t.Error("short code was accepted")
+	}
+	if _, ok := verifyTOTP("not base32!", code, now); ok {
+		t.Error("code for an unreadable secret was accepted")
+	}
+}
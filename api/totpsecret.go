@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+// TOTPKeySize is the length of the key TOTP secrets are encrypted with, AES-256.
+const TOTPKeySize = 32
+
+// totpSecretPrefix marks a stored secret as encrypted, rows written before encryption hold the plain secret.
+const totpSecretPrefix = "v1:"
+
+var ErrTOTPKeyMissing = errors.New("no TOTP encryption key is configured")
+
+// totpCipher returns the AES-GCM cipher built from the server's TOTP key.
+func (server *Server) totpCipher() (cipher.AEAD, error) {
+	if len(server.TOTPKey) != TOTPKeySize {
+		return nil, ErrTOTPKeyMissing
+	}
+	block, err := aes.NewCipher(server.TOTPKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// totpAdditionalData binds a ciphertext to its user, a secret copied to another row does not decrypt.
+func totpAdditionalData(userID int32) []byte {
+	return []byte("totp:" + strconv.Itoa(int(userID)))
+}
+
+// sealTOTPSecret encrypts the secret of the user for storage.
+func (server *Server) sealTOTPSecret(userID int32, secret string) (string, error) {
+	aead, err := server.totpCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(secret), totpAdditionalData(userID))
+	return totpSecretPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// openTOTPSecret returns the plain secret of a stored one, plain secrets are returned as they are.
+func (server *Server) openTOTPSecret(userID int32, stored string) (string, error) {
+	encoded, ok := strings.CutPrefix(stored, totpSecretPrefix)
+	if !ok {
+		return stored, nil
+	}
+
+	aead, err := server.totpCipher()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("totp secret of user %d is malformed", userID)
+	}
+	secret, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], totpAdditionalData(userID))
+	if err != nil {
+		return "", fmt.Errorf("totp secret of user %d does not decrypt: %w", userID, err)
+	}
+	return string(secret), nil
+}
+
+// EncryptTOTPSecrets encrypts the secrets stored before encryption was introduced. It runs at
+// startup, a secret replaced in the meantime by a new enrolment is left alone.
+func (server *Server) EncryptTOTPSecrets(ctx context.Context) error {
+	credentials, err := server.store.ListPlaintextTOTPCredentials(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, credential := range credentials {
+		sealed, err := server.sealTOTPSecret(credential.UserID, credential.Secret)
+		if err != nil {
+			return err
+		}
+		_, err = server.store.ReplaceTOTPSecret(ctx, repo.ReplaceTOTPSecretParams{
+			NewSecret: sealed,
+			UserID:    credential.UserID,
+			OldSecret: credential.Secret,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
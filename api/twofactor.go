@@ -0,0 +1,366 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+const (
+	loginChallengeDuration = 5 * time.Minute
+	// maxLoginChallengeAttempts caps the codes that can be tried against one challenge
+	maxLoginChallengeAttempts = 5
+	recoveryCodeCount         = 10
+)
+
+// newRecoveryCode returns an 80 bit code formatted as xxxx-xxxx-xxxx-xxxx so it is easy to copy by hand.
+func newRecoveryCode() (string, error) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	code := secret[:16]
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16], nil
+}
+
+// normalizeRecoveryCode makes the hash independent of case, dashes and spaces typed by the user.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// totpEnabled reports whether the user finished TOTP enrolment.
+func (server *Server) totpEnabled(c *gin.Context, userID int32) (bool, error) {
+	credential, err := server.store.GetTOTPCredential(c, userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return credential.EnabledAt.Valid, nil
+}
+
+// checkSecondFactor accepts either a TOTP code that was not used before or an unused recovery code.
+func (server *Server) checkSecondFactor(c *gin.Context, credential repo.TotpCredential, code string, recoveryCode string) (bool, error) {
+	if code != "" {
+		secret, err := server.openTOTPSecret(credential.UserID, credential.Secret)
+		if err != nil {
+			return false, err
+		}
+		step, ok := verifyTOTP(secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		rows, err := server.store.UpdateTOTPLastUsedStep(c, repo.UpdateTOTPLastUsedStepParams{
+			UserID:       credential.UserID,
+			LastUsedStep: step,
+		})
+		return rows == 1, err
+	}
+
+	if recoveryCode != "" {
+		rows, err := server.store.UseRecoveryCode(c, repo.UseRecoveryCodeParams{
+			UserID:   credential.UserID,
+			CodeHash: hashToken(normalizeRecoveryCode(recoveryCode)),
+		})
+		return rows == 1, err
+	}
+
+	return false, nil
+}
+
+// enroll: create a new pending secret
+type enrollTOTPResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+func (server *Server) enrollTOTP(c *gin.Context) {
+	claims := authClaims(c)
+
+	enabled, err := server.totpEnabled(c, claims.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+
+	user, err := server.store.GetUser(c, claims.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create secret"})
+		return
+	}
+	// only the encrypted secret is stored, the user gets the plain one once to set up their app
+	sealed, err := server.sealTOTPSecret(user.ID, secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create secret"})
+		return
+	}
+	_, err = server.store.UpsertTOTPCredential(c, repo.UpsertTOTPCredentialParams{
+		UserID: user.ID,
+		Secret: sealed,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollTOTPResponse{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(secret, user.Email),
+	})
+}
+
+// verify: the first valid code turns two-factor authentication on and returns the recovery codes
+type totpCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (server *Server) verifyTOTPEnrollment(c *gin.Context) {
+	var req totpCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims := authClaims(c)
+	credential, err := server.store.GetTOTPCredential(c, claims.ID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start the enrolment first"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if credential.EnabledAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+
+	ok, err := server.checkSecondFactor(c, credential, req.Code, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+		return
+	}
+
+	if err := server.store.EnableTOTPCredential(c, claims.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	codes, err := server.replaceRecoveryCodes(c, claims.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// replaceRecoveryCodes drops the user's recovery codes and returns a fresh set, only their hashes are stored.
+func (server *Server) replaceRecoveryCodes(c *gin.Context, userID int32) ([]string, error) {
+	if err := server.store.DeleteRecoveryCodes(c, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		err = server.store.CreateRecoveryCode(c, repo.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: hashToken(normalizeRecoveryCode(code)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// disable: needs the password and a second factor
+type disableTOTPRequest struct {
+	Password     string `json:"password" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code" binding:"required_without=Code"`
+}
+
+func (server *Server) disableTOTP(c *gin.Context) {
+	var req disableTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims := authClaims(c)
+	user, err := server.store.GetUser(c, claims.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if err := CheckPassword(req.Password, user.HashedPassword); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid password"})
+		return
+	}
+
+	credential, err := server.store.GetTOTPCredential(c, user.ID)
+	if err != nil || !credential.EnabledAt.Valid {
+		if err == nil || err == pgx.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "two-factor authentication is not enabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	ok, err := server.checkSecondFactor(c, credential, req.Code, req.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid code"})
+		return
+	}
+
+	if err := server.store.DeleteTOTPCredential(c, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if err := server.store.DeleteRecoveryCodes(c, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// login step one: the password was right, hand out a short lived challenge instead of tokens
+type loginChallengeResponse struct {
+	MFARequired        bool      `json:"mfa_required"`
+	ChallengeToken     string    `json:"challenge_token"`
+	ChallengeExpiresAt time.Time `json:"challenge_expires_at"`
+}
+
+func (server *Server) startLoginChallenge(c *gin.Context, user repo.User) {
+	token, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create challenge"})
+		return
+	}
+
+	expiresAt := time.Now().Add(loginChallengeDuration)
+	_, err = server.store.CreateLoginChallenge(c, repo.CreateLoginChallengeParams{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, loginChallengeResponse{
+		MFARequired:        true,
+		ChallengeToken:     token,
+		ChallengeExpiresAt: expiresAt,
+	})
+}
+
+// login step two: exchange the challenge and a TOTP or recovery code for the real tokens
+type loginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode   string `json:"recovery_code" binding:"required_without=Code"`
+}
+
+func (server *Server) loginTwoFactor(c *gin.Context) {
+	var req loginTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// every try counts against the challenge, so codes cannot be brute forced
+	challenge, err := server.store.AttemptLoginChallenge(c, repo.AttemptLoginChallengeParams{
+		TokenHash: hashToken(req.ChallengeToken),
+		Attempts:  maxLoginChallengeAttempts,
+	})
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired challenge"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	user, err := server.store.GetUser(c, challenge.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	// wrong codes count in the login throttle too, a new challenge from the password does not reset them
+	if !server.checkLoginThrottle(c, user.Email) {
+		return
+	}
+
+	credential, err := server.store.GetTOTPCredential(c, challenge.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	ok, err := server.checkSecondFactor(c, credential, req.Code, req.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if !ok {
+		server.recordLoginFailures(c, user.Email)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+
+	rows, err := server.store.UseLoginChallenge(c, challenge.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if rows == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired challenge"})
+		return
+	}
+
+	server.loginSucceeded(c, user.Email)
+	server.completeLogin(c, user)
+}
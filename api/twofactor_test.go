@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+// newTwoFactorServer returns a server where testUser has TOTP enabled with rfc6238Secret,
+// stored encrypted. Every challenge token names a fresh challenge.
+func newTwoFactorServer(t *testing.T) (*Server, *fakeDB, *fakeThrottles) {
+	server, db := newTestServer(t)
+	server.TOTPKey = bytes.Repeat([]byte{1}, TOTPKeySize)
+
+	sealed, err := server.sealTOTPSecret(testUser.ID, rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	credential := repo.TotpCredential{
+		UserID:    testUser.ID,
+		Secret:    sealed,
+		EnabledAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+	}
+	db.on("GetTOTPCredential", func(...interface{}) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return credential, nil
+	})
+	db.on("UpdateTOTPLastUsedStep", func(args ...interface{}) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if step := args[1].(int64); credential.LastUsedStep < step {
+			credential.LastUsedStep = step
+			return int64(1), nil
+		}
+		return int64(0), nil
+	})
+
+	db.returns("AttemptLoginChallenge", repo.LoginChallenge{ID: 1, UserID: testUser.ID}, nil)
+	db.returns("UseLoginChallenge", int64(1), nil)
+	db.returns("GetUser", testUser, nil)
+	db.returns("CreateLoginSession", repo.LoginSession{}, nil)
+	db.returns("CreateSession", repo.Session{}, nil)
+	return server, db, newFakeThrottles(db)
+}
+
+func loginTwoFactor(server *Server, code string) int {
+	body := `{"challenge_token": "challenge", "code": "` + code + `"}`
+	return serve(server, http.MethodPost, "/login/2fa", body, "").Code
+}
+
+func currentTOTPCode(t *testing.T, offset int64) string {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(key, time.Now().Unix()/totpPeriod+offset)
+}
+
+func TestLoginTwoFactorRefusesReplayedCode(t *testing.T) {
+	server, _, _ := newTwoFactorServer(t)
+	code := currentTOTPCode(t, 0)
+
+	if status := loginTwoFactor(server, code); status != http.StatusOK {
+		t.Fatalf("first use: status = %d, want 200", status)
+	}
+	if status := loginTwoFactor(server, code); status != http.StatusUnauthorized {
+		t.Errorf("replay: status = %d, want 401", status)
+	}
+	// the previous step is within the clock skew, but older than the step used
+	if status := loginTwoFactor(server, currentTOTPCode(t, -1)); status != http.StatusUnauthorized {
+		t.Errorf("older step: status = %d, want 401", status)
+	}
+}
+
+func TestLoginTwoFactorFailuresAreThrottled(t *testing.T) {
+	server, _, throttles := newTwoFactorServer(t)
+
+	// every wrong code counts, whichever challenge it was sent for
+	for i := 0; i <= freeLoginFailures; i++ {
+		if status := loginTwoFactor(server, "000000"); status != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status = %d, want 401", i+1, status)
+		}
+	}
+	if row, _ := throttles.get(accountThrottleKey(testUser.Email)); row.Failures != freeLoginFailures+1 {
+		t.Fatalf("account failures = %d, want %d", row.Failures, freeLoginFailures+1)
+	}
+
+	if status := loginTwoFactor(server, currentTOTPCode(t, 0)); status != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", status)
+	}
+}
+
+func TestTOTPSecretEncryption(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.TOTPKey = bytes.Repeat([]byte{1}, TOTPKeySize)
+
+	sealed, err := server.sealTOTPSecret(testUser.ID, rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed == rfc6238Secret || !bytes.HasPrefix([]byte(sealed), []byte(totpSecretPrefix)) {
+		t.Fatalf("secret was not encrypted: %q", sealed)
+	}
+
+	opened, err := server.openTOTPSecret(testUser.ID, sealed)
+	if err != nil || opened != rfc6238Secret {
+		t.Fatalf("openTOTPSecret = %q, %v", opened, err)
+	}
+	// a secret copied to another account does not open there
+	if _, err := server.openTOTPSecret(testUser.ID+1, sealed); err == nil {
+		t.Error("secret opened for another user")
+	}
+	// secrets stored before encryption still work until they are migrated
+	if opened, err := server.openTOTPSecret(testUser.ID, rfc6238Secret); err != nil || opened != rfc6238Secret {
+		t.Errorf("plaintext secret: %q, %v", opened, err)
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/postquery"
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+var ErrNoDatabase = errors.New("the server has no database connection")
+
+// Database runs the queries built at request time, like the post list, and starts the transactions
+// statements that must succeed or fail together run in. A *pgxpool.Pool is one.
+type Database interface {
+	repo.DBTX
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// inTx runs fn with queries bound to a single transaction, committed when fn returns nil
+// and rolled back otherwise.
+func (server *Server) inTx(ctx context.Context, fn func(q *repo.Queries) error) error {
+	if server.DB == nil {
+		return ErrNoDatabase
+	}
+	tx, err := server.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	//nolint:errcheck // does nothing once the transaction is committed
+	defer tx.Rollback(ctx)
+
+	if err := fn(server.store.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// listPostsFiltered reads the post list, built at request time outside the sqlc queries.
+func (server *Server) listPostsFiltered(ctx context.Context, arg postquery.Params) ([]postquery.Row, error) {
+	if server.DB == nil {
+		return nil, ErrNoDatabase
+	}
+	return postquery.List(ctx, server.DB, arg)
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+// userResponse is what we expose about a user, never the password hash.
+type userResponse struct {
+	ID            int32     `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	Role          string    `json:"role"`
+	EmailVerified bool      `json:"email_verified"`
+	InvitedBy     *int32    `json:"invited_by"`
+	CreatedAt     time.Time `json:"created_at"`
+	// DeletionScheduledAt is set while the account waits for deletion
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+func newUserResponse(user repo.User) userResponse {
+	rsp := userResponse{
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		Role:          user.Role,
+		EmailVerified: user.VerifiedAt.Valid,
+		InvitedBy:     user.InvitedBy,
+		CreatedAt:     user.CreatedAt,
+	}
+	if user.DeletionScheduledAt.Valid {
+		rsp.DeletionScheduledAt = &user.DeletionScheduledAt.Time
+	}
+	return rsp
+}
+
+// isUniqueViolation reports whether err comes from a UNIQUE constraint.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err comes from a FOREIGN KEY constraint.
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
+
+// normalizeEmail is the form emails are stored and compared in.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// userByLoginIdentifier finds the account for a username or an email, both compared without case.
+func (server *Server) userByLoginIdentifier(c *gin.Context, identifier string) (repo.User, error) {
+	if strings.Contains(identifier, "@") {
+		return server.store.GetUseryByEmail(c, normalizeEmail(identifier))
+	}
+	return server.store.GetUserByUsername(c, identifier)
+}
+
+// currentUser loads the caller from the database, answering the request itself when that fails.
+func (server *Server) currentUser(c *gin.Context) (repo.User, bool) {
+	user, err := server.store.GetUser(c, authClaims(c).ID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return repo.User{}, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return repo.User{}, false
+	}
+	return user, true
+}
+
+// recentLoginWindow is how long after logging in an account without a password can make sensitive changes.
+const recentLoginWindow = 10 * time.Minute
+
+// reauthenticate checks the caller is the account owner before a sensitive change, answering the
+// request itself when they are not. Accounts without a password, created through single sign-on,
+// prove it with a login from the last few minutes instead.
+func (server *Server) reauthenticate(c *gin.Context, user repo.User, password string) bool {
+	if user.HashedPassword != "" {
+		if err := CheckPassword(password, user.HashedPassword); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "password is incorrect"})
+			return false
+		}
+		return true
+	}
+
+	session, err := server.store.GetLoginSessionByFamily(c, repo.GetLoginSessionByFamilyParams{
+		FamilyID: authClaims(c).SessionID,
+		UserID:   user.ID,
+	})
+	if err != nil && err != pgx.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return false
+	}
+	if err == pgx.ErrNoRows || time.Since(session.CreatedAt) > recentLoginWindow {
+		c.JSON(http.StatusForbidden, gin.H{"error": "log in again to confirm it is you"})
+		return false
+	}
+	return true
+}
+
+// get the caller's profile
+func (server *Server) getMe(c *gin.Context) {
+	user, ok := server.currentUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// update the caller's profile
+type updateMeRequest struct {
+	Username string `json:"username" binding:"required,alphanum"`
+}
+
+func (server *Server) updateMe(c *gin.Context) {
+	var req updateMeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := server.currentUser(c)
+	if !ok {
+		return
+	}
+
+	// the password is kept as it is, only the profile fields change
+	user, err := server.store.UpdateUser(c, repo.UpdateUserParams{
+		ID:             user.ID,
+		Username:       req.Username,
+		HashedPassword: user.HashedPassword,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "username already taken"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// change the caller's password. An account without one, created through single sign-on, sets its
+// first password right after logging in
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+func (server *Server) changePassword(c *gin.Context) {
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := server.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !server.reauthenticate(c, user, req.CurrentPassword) {
+		return
+	}
+	if !server.acceptablePassword(c, req.NewPassword, user.Username, user.Email) {
+		return
+	}
+
+	hashedPassword, err := server.PasswordHasher.Hash(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		return
+	}
+
+	err = server.inTx(c, func(q *repo.Queries) error {
+		user, err = replacePassword(c, q, user, hashedPassword)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update password"})
+		return
+	}
+
+	// every other device is logged out, the caller gets a fresh pair of tokens to stay logged in
+	if err := server.revocations.revokeAllBefore(c, user.ID, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+
+	server.completeLogin(c, user)
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+func TestGetMeHidesPasswordHash(t *testing.T) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	user := verifiedUser
+	user.HashedPassword = "$2a$10$secret"
+	db.returns("GetUser", user, nil)
+
+	rec := serve(server, http.MethodGet, "/me", "", accessToken(t, server, testUser, "family"))
+	expectStatus(t, rec, http.StatusOK)
+	if strings.Contains(rec.Body.String(), "secret") || strings.Contains(rec.Body.String(), "hashed_password") {
+		t.Errorf("the response shows the password hash: %s", rec.Body.String())
+	}
+
+	var rsp userResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.ID != testUser.ID || rsp.Username != testUser.Username || rsp.Email != testUser.Email || !rsp.EmailVerified {
+		t.Errorf("profile = %+v", rsp)
+	}
+}
+
+func TestUpdateMe(t *testing.T) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	db.returns("GetUser", verifiedUser, nil)
+	db.on("UpdateUser", func(args ...interface{}) (interface{}, error) {
+		if args[1] == "taken" {
+			return nil, &pgconn.PgError{Code: "23505"}
+		}
+		user := verifiedUser
+		user.Username = args[1].(string)
+		return user, nil
+	})
+	token := accessToken(t, server, testUser, "family")
+
+	expectStatus(t, serve(server, http.MethodPatch, "/me", `{"username": "alice2"}`, token), http.StatusOK)
+	expectStatus(t, serve(server, http.MethodPatch, "/me", `{"username": "taken"}`, token), http.StatusConflict)
+	expectStatus(t, serve(server, http.MethodPatch, "/me", `{"username": "not valid"}`, token), http.StatusBadRequest)
+
+	// the password hash is written back untouched
+	if calls := db.called("UpdateUser"); len(calls) != 2 || calls[0][0] != testUser.ID || calls[0][2] != verifiedUser.HashedPassword {
+		t.Errorf("UpdateUser calls = %v", calls)
+	}
+}
+
+// newPasswordChangeServer returns a server where testUser's password is "correct horse".
+func newPasswordChangeServer(t *testing.T) (*Server, *fakeDB) {
+	server, db := newTestServer(t)
+	newFakeRevocations(db)
+	server.PasswordHasher = BcryptHasher{Cost: bcrypt.MinCost}
+	hash, err := server.PasswordHasher.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := verifiedUser
+	user.HashedPassword = hash
+	db.returns("GetUser", user, nil)
+	db.on("UpdateUser", func(args ...interface{}) (interface{}, error) {
+		user.HashedPassword = args[2].(string)
+		return user, nil
+	})
+	db.returns("RevokeUserSessions", nil, nil)
+	db.returns("RevokeUserAPIKeys", nil, nil)
+	db.returns("CreateLoginSession", nil, nil)
+	db.returns("CreateSession", repo.Session{}, nil)
+	return server, db
+}
+
+func TestChangePassword(t *testing.T) {
+	server, db := newPasswordChangeServer(t)
+	token := accessToken(t, server, testUser, "family")
+
+	rec := serve(server, http.MethodPost, "/me/password", `{"current_password": "correct horse", "new_password": "`+signupPassword+`"}`, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	updated := db.called("UpdateUser")
+	if len(updated) != 1 || CheckPassword(signupPassword, updated[0][2].(string)) != nil {
+		t.Fatalf("UpdateUser calls = %v, want the new password hashed", updated)
+	}
+	// the other devices are logged out and the API keys revoked, the caller stays logged in with new tokens
+	if len(db.called("SetTokensValidAfter")) != 1 || len(db.called("RevokeUserSessions")) != 1 {
+		t.Error("the other sessions were not revoked")
+	}
+	if revoked := db.called("RevokeUserAPIKeys"); len(revoked) != 1 || revoked[0][0] != testUser.ID {
+		t.Errorf("RevokeUserAPIKeys calls = %v, want one for the caller", revoked)
+	}
+	if len(db.called("commit")) != 1 {
+		t.Error("the password change was not committed")
+	}
+	var tokens tokenPair
+	if err := json.Unmarshal(rec.Body.Bytes(), &tokens); err != nil || tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Errorf("no new tokens: %s", rec.Body.String())
+	}
+}
+
+func TestChangePasswordRollsBack(t *testing.T) {
+	server, db := newPasswordChangeServer(t)
+	db.returns("RevokeUserAPIKeys", nil, errors.New("connection reset"))
+
+	rec := serve(server, http.MethodPost, "/me/password", `{"current_password": "correct horse", "new_password": "`+signupPassword+`"}`, accessToken(t, server, testUser, "family"))
+	expectStatus(t, rec, http.StatusInternalServerError)
+	// the new password is not set while the API keys of the old one still work
+	if len(db.called("rollback")) != 1 || len(db.called("commit")) != 0 {
+		t.Error("the password change was not rolled back")
+	}
+	if len(db.called("SetTokensValidAfter")) != 0 || len(db.called("CreateSession")) != 0 {
+		t.Error("the change went on after the rollback")
+	}
+}
+
+func TestChangePasswordRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "wrong current password", body: `{"current_password": "wrong", "new_password": "` + signupPassword + `"}`, want: http.StatusForbidden},
+		{name: "weak new password", body: `{"current_password": "correct horse", "new_password": "password"}`, want: http.StatusBadRequest},
+		{name: "new password like the username", body: `{"current_password": "correct horse", "new_password": "alice-alice"}`, want: http.StatusBadRequest},
+		{name: "no current password", body: `{"new_password": "` + signupPassword + `"}`, want: http.StatusForbidden},
+		{name: "no new password", body: `{"current_password": "correct horse"}`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, db := newPasswordChangeServer(t)
+
+			expectStatus(t, serve(server, http.MethodPost, "/me/password", tt.body, accessToken(t, server, testUser, "family")), tt.want)
+			if len(db.called("UpdateUser")) != 0 {
+				t.Error("the password was changed")
+			}
+		})
+	}
+}
+
+// newPasswordlessServer returns a server where testUser has no password, as accounts created through
+// single sign-on, and logged in at loggedInAt. A zero time means the login session is gone.
+func newPasswordlessServer(t *testing.T, loggedInAt time.Time) (*Server, *fakeDB) {
+	server, db := newPasswordChangeServer(t)
+	db.returns("GetUser", verifiedUser, nil)
+	db.on("GetLoginSessionByFamily", func(args ...interface{}) (interface{}, error) {
+		if loggedInAt.IsZero() || args[0] != "family" || args[1] != testUser.ID {
+			return nil, pgx.ErrNoRows
+		}
+		return repo.LoginSession{ID: 1, UserID: testUser.ID, FamilyID: "family", CreatedAt: loggedInAt, LastSeenAt: time.Now()}, nil
+	})
+	return server, db
+}
+
+func TestChangePasswordWithoutPassword(t *testing.T) {
+	tests := []struct {
+		name       string
+		loggedInAt time.Time
+		want       int
+	}{
+		{name: "just logged in", loggedInAt: time.Now().Add(-time.Minute), want: http.StatusOK},
+		{name: "logged in long ago", loggedInAt: time.Now().Add(-time.Hour), want: http.StatusForbidden},
+		{name: "session revoked", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, db := newPasswordlessServer(t, tt.loggedInAt)
+
+			// a refreshed access token keeps the time of the login, not of the refresh
+			expectStatus(t, serve(server, http.MethodPost, "/me/password", `{"new_password": "`+signupPassword+`"}`, accessToken(t, server, testUser, "family")), tt.want)
+			if changed := len(db.called("UpdateUser")) == 1; changed != (tt.want == http.StatusOK) {
+				t.Errorf("password changed = %v", changed)
+			}
+		})
+	}
+}
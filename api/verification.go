@@ -0,0 +1,166 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+	"github.com/Iknite-Space/sqlc-example-api/mailer"
+)
+
+var ErrEmailNotVerified = errors.New("email address is not verified")
+
+const (
+	emailVerificationTokenDuration = 24 * time.Hour
+	// a user can ask for a new verification email once a minute and at most 5 times an hour
+	verificationResendInterval = time.Minute
+	verificationResendLimit    = 5
+)
+
+// sendVerificationEmail replaces any pending verification link of the user with a new one and mails it.
+func (server *Server) sendVerificationEmail(c *gin.Context, user repo.User) error {
+	if err := server.store.InvalidateUserEmailVerificationTokens(c, user.ID); err != nil {
+		return err
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	_, err = server.store.CreateEmailVerificationToken(c, repo.CreateEmailVerificationTokenParams{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(emailVerificationTokenDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	link, err := pageLink(server.EmailVerificationURL, token)
+	if err != nil {
+		return err
+	}
+	return server.Mailer.Send(c, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your IkniteConnect email",
+		Body: fmt.Sprintf("Hi %s,\n\nWelcome to IkniteConnect! Confirm your email address with this link, it expires in %s:\n\n%s\n",
+			user.Username, emailVerificationTokenDuration, link),
+	})
+}
+
+// emailVerificationRequired reports whether the user cannot log in yet. An account admitted by its email
+// domain alone proves nothing until the address is verified, invited ones only wait with RequireVerifiedEmail.
+func (server *Server) emailVerificationRequired(user repo.User) bool {
+	if user.VerifiedAt.Valid {
+		return false
+	}
+	return server.RequireVerifiedEmail || user.InvitedBy == nil
+}
+
+// verify email, the web app page the email links to posts the token
+type verifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+func (server *Server) verifyEmail(c *gin.Context) {
+	var req verifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	verificationToken, err := server.store.UseEmailVerificationToken(c, hashToken(req.Token))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired verification token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	if err := server.store.MarkUserVerified(c, verificationToken.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// resend the verification email
+type resendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+func (server *Server) resendVerification(c *gin.Context) {
+	var req resendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// same answer for unknown and already verified accounts
+	rsp := gin.H{"message": "If this account needs verification, a new email has been sent"}
+
+	user, err := server.store.GetUseryByEmail(c, req.Email)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			c.JSON(http.StatusAccepted, rsp)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if user.VerifiedAt.Valid {
+		c.JSON(http.StatusAccepted, rsp)
+		return
+	}
+
+	throttled, err := server.verificationThrottled(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	// a 429 would tell which emails have an unverified account, so the mail is just not sent
+	if throttled {
+		c.JSON(http.StatusAccepted, rsp)
+		return
+	}
+
+	if err := server.sendVerificationEmail(c, user); err != nil {
+		_ = c.Error(err)
+	}
+
+	c.JSON(http.StatusAccepted, rsp)
+}
+
+// verificationThrottled reports whether the user already got too many verification emails recently.
+func (server *Server) verificationThrottled(c *gin.Context, userID int32) (bool, error) {
+	now := time.Now()
+
+	recent, err := server.store.CountEmailVerificationTokensSince(c, repo.CountEmailVerificationTokensSinceParams{
+		UserID:    userID,
+		CreatedAt: now.Add(-verificationResendInterval),
+	})
+	if err != nil {
+		return false, err
+	}
+	if recent > 0 {
+		return true, nil
+	}
+
+	lastHour, err := server.store.CountEmailVerificationTokensSince(c, repo.CountEmailVerificationTokensSinceParams{
+		UserID:    userID,
+		CreatedAt: now.Add(-time.Hour),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return lastHour >= verificationResendLimit, nil
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+	"github.com/Iknite-Space/sqlc-example-api/mailer"
+)
+
+func TestVerificationEmailLinksToVerifyPage(t *testing.T) {
+	server, db := newTestServer(t)
+	var mail bytes.Buffer
+	server.Mailer = mailer.NewLogMailer(&mail)
+	server.EmailVerificationURL = "https://app.example.com/account/verify?lang=en"
+	db.returns("GetUseryByEmail", testUser, nil)
+	db.returns("CountEmailVerificationTokensSince", int64(0), nil)
+	db.returns("InvalidateUserEmailVerificationTokens", nil, nil)
+	db.returns("CreateEmailVerificationToken", repo.EmailVerificationToken{}, nil)
+
+	rec := serve(server, http.MethodPost, "/verify-email/resend", `{"email": "`+testUser.Email+`"}`, "")
+	expectStatus(t, rec, http.StatusAccepted)
+
+	// the link opens the web app page, the API only takes the token in a POST
+	found := regexp.MustCompile(`https://\S+`).FindString(mail.String())
+	link, err := url.Parse(found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Host != "app.example.com" || link.Path != "/account/verify" || link.Query().Get("lang") != "en" {
+		t.Fatalf("link = %q, want the verify page with its query kept", found)
+	}
+	token := link.Query().Get("token")
+	created := db.called("CreateEmailVerificationToken")
+	if len(created) != 1 || created[0][1] != hashToken(token) {
+		t.Fatalf("the link's token is not the one stored: %q", found)
+	}
+
+	db.returns("UseEmailVerificationToken", repo.EmailVerificationToken{UserID: testUser.ID}, nil)
+	db.returns("MarkUserVerified", nil, nil)
+	expectStatus(t, serve(server, http.MethodPost, "/verify-email", `{"token": "`+token+`"}`, ""), http.StatusOK)
+	if used := db.called("UseEmailVerificationToken"); len(used) != 1 || used[0][0] != hashToken(token) {
+		t.Errorf("UseEmailVerificationToken calls = %v", used)
+	}
+}
+
+func TestVerifyEmailOnlyTakesTheTokenInAJSONBody(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	// a token in the URL ends up in access logs and browser history
+	rec := serve(server, http.MethodGet, "/verify-email?token=secret", "", "")
+	if rec.Code != http.StatusNotFound && rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d, want the route gone", rec.Code)
+	}
+	expectStatus(t, serve(server, http.MethodPost, "/verify-email?token=secret", "", ""), http.StatusBadRequest)
+}
+
+func TestResendVerificationAnswersAlike(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(db *fakeDB)
+		wantSent bool
+	}{
+		{
+			name:  "unknown email",
+			setup: func(db *fakeDB) { db.returns("GetUseryByEmail", nil, pgx.ErrNoRows) },
+		},
+		{
+			name: "sent",
+			setup: func(db *fakeDB) {
+				db.returns("GetUseryByEmail", testUser, nil)
+				db.returns("CountEmailVerificationTokensSince", int64(0), nil)
+			},
+			wantSent: true,
+		},
+		{
+			name: "sent a moment ago",
+			setup: func(db *fakeDB) {
+				db.returns("GetUseryByEmail", testUser, nil)
+				db.returns("CountEmailVerificationTokensSince", int64(1), nil)
+			},
+		},
+		{
+			name: "hourly limit reached",
+			setup: func(db *fakeDB) {
+				db.returns("GetUseryByEmail", testUser, nil)
+				db.on("CountEmailVerificationTokensSince", func(args ...interface{}) (interface{}, error) {
+					// nothing in the last minute, the limit within the hour
+					if len(db.called("CountEmailVerificationTokensSince")) == 1 {
+						return int64(0), nil
+					}
+					return int64(verificationResendLimit), nil
+				})
+			},
+		},
+	}
+
+	var want string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, db := newTestServer(t)
+			tt.setup(db)
+			db.returns("InvalidateUserEmailVerificationTokens", nil, nil)
+			db.returns("CreateEmailVerificationToken", repo.EmailVerificationToken{}, nil)
+
+			rec := serve(server, http.MethodPost, "/verify-email/resend", `{"email": "`+testUser.Email+`"}`, "")
+			expectStatus(t, rec, http.StatusAccepted)
+			if want == "" {
+				want = rec.Body.String()
+			} else if rec.Body.String() != want {
+				t.Errorf("body = %s, want %s", rec.Body.String(), want)
+			}
+
+			if sent := len(db.called("CreateEmailVerificationToken")) == 1; sent != tt.wantSent {
+				t.Errorf("email sent = %v, want %v", sent, tt.wantSent)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Iknite-Space/sqlc-example-api/api"
+	"github.com/Iknite-Space/sqlc-example-api/passwordpolicy"
+)
+
+// The environment modes the server can run in. Anything but dev gets the strict checks.
+const (
+	EnvDev     = "dev"
+	EnvStaging = "staging"
+	EnvProd    = "prod"
+)
+
+// The ways emails can be delivered.
+const (
+	MailDriverSMTP = "smtp"
+	MailDriverLog  = "log"
+)
+
+const (
+	// minJWTSecretLength is the shortest HMAC secret we accept outside of dev, 32 bytes matches the HS256 output size.
+	minJWTSecretLength = 32
+	// minJWTSecretEntropy is the minimum estimated entropy in bits per character, it rejects things like "aaaa..." or "passwordpassword...".
+	minJWTSecretEntropy = 3.0
+	// minArgon2Memory is the 19 MiB floor OWASP gives for argon2id.
+	minArgon2Memory = 19 * 1024
+)
+
+// The placeholder secrets of .env.example, so a copy of it starts in dev. They are public and
+// refused everywhere else.
+const (
+	devJWTSecret         = "dev-only-jwt-secret-do-not-deploy"
+	devTOTPEncryptionKey = "ZGV2LW9ubHktdG90cC1rZXktZG8tbm90LWRlcGxveSE="
+)
+
+// Validate checks the security critical settings and returns every problem it finds at once.
+func (cfg Config) Validate() error {
+	var errs []error
+
+	switch cfg.Environment {
+	case EnvDev, EnvStaging, EnvProd:
+	default:
+		errs = append(errs, fmt.Errorf("APP_ENV must be one of %s, %s or %s, got %q", EnvDev, EnvStaging, EnvProd, cfg.Environment))
+	}
+	strict := cfg.Environment != EnvDev
+
+	// the shared secret only signs tokens when no asymmetric keys are configured
+	if cfg.JWTKeyDir == "" {
+		if err := validateJWTSecret(cfg.JWTSecret, strict); err != nil {
+			errs = append(errs, err)
+		}
+	} else if cfg.JWTActiveKeyID == "" {
+		errs = append(errs, errors.New("JWT_ACTIVE_KEY_ID is required when JWT_KEY_DIR is set"))
+	}
+
+	if key, err := base64.StdEncoding.DecodeString(cfg.TOTPEncryptionKey); err != nil || len(key) != api.TOTPKeySize {
+		errs = append(errs, fmt.Errorf("TOTP_ENCRYPTION_KEY must be %d random bytes in base64, generate one with: openssl rand -base64 %d", api.TOTPKeySize, api.TOTPKeySize))
+	} else if strict && cfg.TOTPEncryptionKey == devTOTPEncryptionKey {
+		errs = append(errs, fmt.Errorf("TOTP_ENCRYPTION_KEY is the .env.example placeholder, only allowed in %s", EnvDev))
+	}
+
+	if strict && cfg.DB.TLSDisabled {
+		errs = append(errs, fmt.Errorf("DB_TLS_DISABLED is only allowed in %s", EnvDev))
+	}
+
+	switch cfg.Mail.Driver {
+	case MailDriverSMTP:
+		if cfg.Mail.SMTPHost == "" || cfg.Mail.From == "" {
+			errs = append(errs, errors.New("SMTP_HOST and MAIL_FROM are required when MAIL_DRIVER is smtp"))
+		}
+	case MailDriverLog:
+		if cfg.Environment == EnvProd {
+			errs = append(errs, fmt.Errorf("MAIL_DRIVER %s is not allowed in %s", MailDriverLog, EnvProd))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("MAIL_DRIVER must be %s or %s, got %q", MailDriverSMTP, MailDriverLog, cfg.Mail.Driver))
+	}
+
+	if err := validatePageURL("PASSWORD_RESET_URL", cfg.PasswordResetURL, cfg.Environment); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validatePageURL("EMAIL_VERIFICATION_URL", cfg.EmailVerificationURL, cfg.Environment); err != nil {
+		errs = append(errs, err)
+	}
+
+	if cfg.Login.MaxFailures < 1 || cfg.Login.MaxFailuresPerIP < cfg.Login.MaxFailures {
+		errs = append(errs, errors.New("LOGIN_MAX_FAILURES must be at least 1 and not above LOGIN_MAX_FAILURES_PER_IP"))
+	}
+	if cfg.Login.LockoutDuration <= 0 {
+		errs = append(errs, errors.New("LOGIN_LOCKOUT_DURATION must be positive"))
+	}
+	for _, proxy := range nonEmpty(cfg.TrustedProxies) {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				errs = append(errs, fmt.Errorf("TRUSTED_PROXIES entry %q is not an IP or CIDR", proxy))
+			}
+		}
+	}
+
+	switch cfg.AccountDeletion.Mode {
+	case api.AccountDeletionHard, api.AccountDeletionAnonymize:
+	default:
+		errs = append(errs, fmt.Errorf("ACCOUNT_DELETION_MODE must be %s or %s, got %q", api.AccountDeletionHard, api.AccountDeletionAnonymize, cfg.AccountDeletion.Mode))
+	}
+	if cfg.AccountDeletion.GracePeriod < 0 {
+		errs = append(errs, errors.New("ACCOUNT_DELETION_GRACE_PERIOD cannot be negative"))
+	}
+
+	switch cfg.PasswordHash.Algorithm {
+	case api.PasswordHashBcrypt:
+		if cfg.PasswordHash.BcryptCost < bcrypt.DefaultCost || cfg.PasswordHash.BcryptCost > bcrypt.MaxCost {
+			errs = append(errs, fmt.Errorf("PASSWORD_BCRYPT_COST must be between %d and %d, got %d", bcrypt.DefaultCost, bcrypt.MaxCost, cfg.PasswordHash.BcryptCost))
+		}
+	case api.PasswordHashArgon2id:
+		if cfg.PasswordHash.Argon2Iterations < 1 || cfg.PasswordHash.Argon2Parallelism < 1 {
+			errs = append(errs, errors.New("PASSWORD_ARGON2_ITERATIONS and PASSWORD_ARGON2_PARALLELISM must be at least 1"))
+		}
+		if cfg.PasswordHash.Argon2Memory < minArgon2Memory {
+			errs = append(errs, fmt.Errorf("PASSWORD_ARGON2_MEMORY_KIB must be at least %d, got %d", minArgon2Memory, cfg.PasswordHash.Argon2Memory))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("PASSWORD_HASH_ALGORITHM must be %s or %s, got %q", api.PasswordHashBcrypt, api.PasswordHashArgon2id, cfg.PasswordHash.Algorithm))
+	}
+
+	if cfg.PasswordPolicy.MinLength < passwordpolicy.DefaultMinLength || cfg.PasswordPolicy.MinLength > passwordpolicy.DefaultMaxLength {
+		errs = append(errs, fmt.Errorf("PASSWORD_MIN_LENGTH must be between %d and %d, got %d", passwordpolicy.DefaultMinLength, passwordpolicy.DefaultMaxLength, cfg.PasswordPolicy.MinLength))
+	}
+
+	if cfg.OIDC.IssuerURL != "" {
+		if cfg.OIDC.ClientID == "" {
+			errs = append(errs, errors.New("OIDC_CLIENT_ID is required when OIDC_ISSUER_URL is set"))
+		}
+		if cfg.Environment == EnvProd && !strings.HasPrefix(cfg.OIDC.IssuerURL, "https://") {
+			errs = append(errs, fmt.Errorf("OIDC_ISSUER_URL must use https in %s", EnvProd))
+		}
+	}
+
+	if cfg.AccessTokenDuration <= 0 || cfg.AccessTokenDuration > time.Hour {
+		errs = append(errs, fmt.Errorf("ACCESS_TOKEN_DURATION must be between 0 and 1h, got %s", cfg.AccessTokenDuration))
+	}
+	if cfg.RefreshTokenDuration <= cfg.AccessTokenDuration {
+		errs = append(errs, errors.New("REFRESH_TOKEN_DURATION must be longer than ACCESS_TOKEN_DURATION"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateJWTSecret refuses an empty secret everywhere, and the placeholder or a short or low entropy one outside of dev.
+func validateJWTSecret(secret string, strict bool) error {
+	if strings.TrimSpace(secret) == "" {
+		return errors.New("JWT_SECRET is required, generate one with: openssl rand -base64 48")
+	}
+	if !strict {
+		return nil
+	}
+
+	if secret == devJWTSecret {
+		return fmt.Errorf("JWT_SECRET is the .env.example placeholder, only allowed in %s", EnvDev)
+	}
+	if len(secret) < minJWTSecretLength {
+		return fmt.Errorf("JWT_SECRET must be at least %d characters, got %d", minJWTSecretLength, len(secret))
+	}
+	if entropy := shannonEntropy(secret); entropy < minJWTSecretEntropy {
+		return fmt.Errorf("JWT_SECRET is too predictable (%.1f bits per character, need %.1f), use a random value", entropy, minJWTSecretEntropy)
+	}
+
+	return nil
+}
+
+// validatePageURL checks the URL of a web app page emails link to, tokens travel in it so prod needs https.
+func validatePageURL(setting string, page string, env string) error {
+	link, err := url.Parse(page)
+	if err != nil || (link.Scheme != "https" && link.Scheme != "http") || link.Host == "" {
+		return fmt.Errorf("%s must be an absolute http(s) URL, got %q", setting, page)
+	}
+	if env == EnvProd && link.Scheme != "https" {
+		return fmt.Errorf("%s must use https in %s", setting, EnvProd)
+	}
+	return nil
+}
+
+// nonEmpty drops the blank entries conf produces for an empty list variable.
+func nonEmpty(values []string) []string {
+	var out []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// shannonEntropy estimates the entropy of s in bits per character from its character frequencies.
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+
+	var entropy float64
+	for _, n := range counts {
+		p := float64(n) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
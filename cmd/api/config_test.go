@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/conf/v3"
+	"github.com/joho/godotenv"
+)
+
+// exampleConfig parses .env.example the way the server parses its .env.
+func exampleConfig(t *testing.T) Config {
+	t.Helper()
+	env, err := godotenv.Read("../../.env.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+
+	// conf also reads the command line, which holds the test flags here
+	args := os.Args
+	os.Args = args[:1]
+	defer func() { os.Args = args }()
+
+	var cfg Config
+	if _, err := conf.Parse("", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// expectProblems fails the test unless err names every one of the settings.
+func expectProblems(t *testing.T, err error, settings ...string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("Validate() = nil, want problems with %v", settings)
+	}
+	for _, setting := range settings {
+		if !strings.Contains(err.Error(), setting) {
+			t.Errorf("Validate() = %v, want a problem with %s", err, setting)
+		}
+	}
+}
+
+func TestEnvExampleStartsInDev(t *testing.T) {
+	cfg := exampleConfig(t)
+	if cfg.Environment != EnvDev {
+		t.Fatalf("APP_ENV = %q, want %q", cfg.Environment, EnvDev)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestValidateRefusesDevSettingsOutsideDev(t *testing.T) {
+	cfg := exampleConfig(t)
+	cfg.Environment = EnvStaging
+	expectProblems(t, cfg.Validate(), "JWT_SECRET", "TOTP_ENCRYPTION_KEY", "DB_TLS_DISABLED")
+
+	cfg.Environment = EnvProd
+	expectProblems(t, cfg.Validate(), "JWT_SECRET", "TOTP_ENCRYPTION_KEY", "DB_TLS_DISABLED", "MAIL_DRIVER", "PASSWORD_RESET_URL", "EMAIL_VERIFICATION_URL")
+}
+
+// prodConfig returns the example configuration with the settings production needs.
+func prodConfig(t *testing.T) Config {
+	t.Helper()
+	cfg := exampleConfig(t)
+	cfg.Environment = EnvProd
+	cfg.DB.TLSDisabled = false
+	cfg.JWTSecret = "q7Rw1mZ0xVb4Lk9sTn2YhPc8JdE6fUa3"
+	cfg.TOTPEncryptionKey = "Vb8z2Qk1mR7xLw4sTn9YhPc3JdE6fUa0Gi5oKp2Nr1c="
+	cfg.PasswordResetURL = "https://app.iknite.com/reset-password"
+	cfg.EmailVerificationURL = "https://app.iknite.com/verify-email"
+	cfg.Mail.Driver = MailDriverSMTP
+	cfg.Mail.SMTPHost = "smtp.iknite.com"
+	return cfg
+}
+
+func TestValidateAcceptsProductionSettings(t *testing.T) {
+	cfg := prodConfig(t)
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	// asymmetric keys replace the shared secret
+	cfg.JWTSecret = ""
+	cfg.JWTKeyDir = "/etc/iknite/keys"
+	cfg.JWTActiveKeyID = "2024-06"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() with a key directory = %v", err)
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(cfg *Config)
+		setting string
+	}{
+		{name: "unknown environment", change: func(cfg *Config) { cfg.Environment = "production" }, setting: "APP_ENV"},
+		{name: "no jwt secret", change: func(cfg *Config) { cfg.JWTSecret = "" }, setting: "JWT_SECRET"},
+		{name: "short jwt secret", change: func(cfg *Config) { cfg.JWTSecret = "s3cr3t" }, setting: "JWT_SECRET"},
+		{name: "predictable jwt secret", change: func(cfg *Config) { cfg.JWTSecret = strings.Repeat("ab", 20) }, setting: "JWT_SECRET"},
+		{name: "key directory without active key", change: func(cfg *Config) { cfg.JWTKeyDir = "/etc/iknite/keys" }, setting: "JWT_ACTIVE_KEY_ID"},
+		{name: "totp key of the wrong size", change: func(cfg *Config) { cfg.TOTPEncryptionKey = "c2hvcnQ=" }, setting: "TOTP_ENCRYPTION_KEY"},
+		{name: "smtp without host", change: func(cfg *Config) { cfg.Mail.SMTPHost = "" }, setting: "SMTP_HOST"},
+		{name: "relative reset url", change: func(cfg *Config) { cfg.PasswordResetURL = "/reset-password" }, setting: "PASSWORD_RESET_URL"},
+		{name: "no verification page", change: func(cfg *Config) { cfg.EmailVerificationURL = "" }, setting: "EMAIL_VERIFICATION_URL"},
+		{name: "untrusted proxy entry", change: func(cfg *Config) { cfg.TrustedProxies = []string{"proxy.internal"} }, setting: "TRUSTED_PROXIES"},
+		{name: "unknown deletion mode", change: func(cfg *Config) { cfg.AccountDeletion.Mode = "soft" }, setting: "ACCOUNT_DELETION_MODE"},
+		{name: "cheap bcrypt", change: func(cfg *Config) { cfg.PasswordHash.BcryptCost = 4 }, setting: "PASSWORD_BCRYPT_COST"},
+		{name: "short passwords", change: func(cfg *Config) { cfg.PasswordPolicy.MinLength = 6 }, setting: "PASSWORD_MIN_LENGTH"},
+		{name: "http identity provider", change: func(cfg *Config) {
+			cfg.OIDC.IssuerURL = "http://idp.iknite.com"
+			cfg.OIDC.ClientID = "connect"
+		}, setting: "OIDC_ISSUER_URL"},
+		{name: "long lived access tokens", change: func(cfg *Config) { cfg.AccessTokenDuration = cfg.RefreshTokenDuration }, setting: "ACCESS_TOKEN_DURATION"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := prodConfig(t)
+			tt.change(&cfg)
+			expectProblems(t, cfg.Validate(), tt.setting)
+		})
+	}
+}
@@ -3,11 +3,14 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
     "time"
 	"github.com/ardanlabs/conf/v3"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -15,6 +18,9 @@ import (
 
 	"github.com/Iknite-Space/sqlc-example-api/api"
 	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+	"github.com/Iknite-Space/sqlc-example-api/mailer"
+	"github.com/Iknite-Space/sqlc-example-api/oidc"
+	"github.com/Iknite-Space/sqlc-example-api/passwordpolicy"
 )
 
 // DBConfig holds the database configuration. This struct is populated from the .env in the current directory.
@@ -30,10 +36,86 @@ type DBConfig struct {
 
 // Config holds the application configuration. This struct is populated from the .env in the current directory.
 type Config struct {
+	Environment    string `conf:"env:APP_ENV,required"`
 	ListenPort     uint16 `conf:"env:LISTEN_PORT,required"`
 	MigrationsPath string `conf:"env:MIGRATIONS_PATH,required"`
 	DB             DBConfig
-	JWTSecret   string `conf:"env:JWT_SECRET"`
+	JWTSecret   string `conf:"env:JWT_SECRET,mask"`
+	// JWTKeyDir holds the PEM private keys as <kid>.pem files, e.g. keys/2024-01.pem and keys/2024-06.pem,
+	// and retired keys whose private half is gone as <kid>.pub.pem public keys.
+	// When set, tokens are signed with JWTActiveKeyID instead of the shared JWTSecret.
+	JWTKeyDir      string `conf:"env:JWT_KEY_DIR"`
+	JWTActiveKeyID string `conf:"env:JWT_ACTIVE_KEY_ID"`
+	// JWTIssuer and JWTAudience are the iss and aud claims of the access tokens, tokens with others are refused.
+	JWTIssuer   string `conf:"env:JWT_ISSUER,required"`
+	JWTAudience string `conf:"env:JWT_AUDIENCE,required"`
+	// TOTPEncryptionKey is the base64 encoded AES-256 key the TOTP secrets are stored encrypted with.
+	TOTPEncryptionKey string `conf:"env:TOTP_ENCRYPTION_KEY,mask"`
+	AccessTokenDuration  time.Duration `conf:"env:ACCESS_TOKEN_DURATION,default:15m"`
+	RefreshTokenDuration time.Duration `conf:"env:REFRESH_TOKEN_DURATION,default:720h"`
+	BaseURL              string        `conf:"env:APP_BASE_URL,default:http://localhost:8080"`
+	PasswordResetURL     string        `conf:"env:PASSWORD_RESET_URL,required"`     // the web app page reset emails link to
+	EmailVerificationURL string        `conf:"env:EMAIL_VERIFICATION_URL,required"` // the web app page verification emails link to
+	RequireVerifiedEmail bool          `conf:"env:REQUIRE_VERIFIED_EMAIL"`
+	AllowedEmailDomains  []string      `conf:"env:ALLOWED_EMAIL_DOMAINS,default:iknite.com"`
+	TrustedProxies       []string      `conf:"env:TRUSTED_PROXIES"`
+	Login                LoginConfig
+	AccountDeletion      AccountDeletionConfig
+	PasswordHash         PasswordHashConfig
+	PasswordPolicy       PasswordPolicyConfig
+	OIDC                 OIDCConfig
+	Mail                 MailConfig
+}
+
+// LoginConfig holds the brute-force protection settings of the login endpoint.
+type LoginConfig struct {
+	MaxFailures      int32         `conf:"env:LOGIN_MAX_FAILURES,default:10"`
+	MaxFailuresPerIP int32         `conf:"env:LOGIN_MAX_FAILURES_PER_IP,default:50"`
+	LockoutDuration  time.Duration `conf:"env:LOGIN_LOCKOUT_DURATION,default:15m"`
+}
+
+// AccountDeletionConfig controls what happens when users delete their account.
+type AccountDeletionConfig struct {
+	GracePeriod time.Duration `conf:"env:ACCOUNT_DELETION_GRACE_PERIOD,default:720h"`
+	Mode        string        `conf:"env:ACCOUNT_DELETION_MODE,default:delete"`
+}
+
+// PasswordHashConfig picks the algorithm and parameters for new password hashes.
+// Existing hashes keep working and are upgraded the next time their owner logs in.
+type PasswordHashConfig struct {
+	Algorithm         string `conf:"env:PASSWORD_HASH_ALGORITHM,default:bcrypt"`
+	BcryptCost        int    `conf:"env:PASSWORD_BCRYPT_COST,default:12"`
+	Argon2Memory      uint32 `conf:"env:PASSWORD_ARGON2_MEMORY_KIB,default:65536"`
+	Argon2Iterations  uint32 `conf:"env:PASSWORD_ARGON2_ITERATIONS,default:3"`
+	Argon2Parallelism uint8  `conf:"env:PASSWORD_ARGON2_PARALLELISM,default:4"`
+}
+
+// PasswordPolicyConfig sets the rules new passwords must pass. PASSWORD_BREACH_DIR points to a local
+// Pwned Passwords copy split in hash-prefix files, leave it empty to skip the breach check.
+type PasswordPolicyConfig struct {
+	MinLength int    `conf:"env:PASSWORD_MIN_LENGTH,default:8"`
+	BreachDir string `conf:"env:PASSWORD_BREACH_DIR"`
+}
+
+// OIDCConfig enables single sign-on through an OpenID Connect provider, it is off while OIDC_ISSUER_URL is empty.
+// OIDC_REDIRECT_URL defaults to APP_BASE_URL/oidc/callback and must be registered at the provider.
+type OIDCConfig struct {
+	IssuerURL    string   `conf:"env:OIDC_ISSUER_URL"`
+	ClientID     string   `conf:"env:OIDC_CLIENT_ID"`
+	ClientSecret string   `conf:"env:OIDC_CLIENT_SECRET,mask"`
+	RedirectURL  string   `conf:"env:OIDC_REDIRECT_URL"`
+	Scopes       []string `conf:"env:OIDC_SCOPES,default:openid;email;profile"`
+}
+
+// MailConfig selects how emails are delivered. The log driver writes them to MAIL_LOG_FILE (or stdout) for local development.
+type MailConfig struct {
+	Driver       string `conf:"env:MAIL_DRIVER,default:log"`
+	LogFile      string `conf:"env:MAIL_LOG_FILE"`
+	SMTPHost     string `conf:"env:SMTP_HOST"`
+	SMTPPort     uint16 `conf:"env:SMTP_PORT,default:587"`
+	SMTPUsername string `conf:"env:SMTP_USERNAME"`
+	SMTPPassword string `conf:"env:SMTP_PASSWORD,mask"`
+	From         string `conf:"env:MAIL_FROM"`
 }
 
 func main() {
@@ -80,7 +162,63 @@ func run() error {
 	querier := repo.New(db)
 
 	// We create a new http handler using the database querier.
-	handler := api.NewAPIHandler(querier,config.JWTSecret ).WireHttpHandler()
+	apiServer := api.NewAPIHandler(querier, config.JWTSecret)
+	apiServer.DB = db
+	apiServer.AccessTokenDuration = config.AccessTokenDuration
+	apiServer.RefreshTokenDuration = config.RefreshTokenDuration
+	apiServer.JWTIssuer = config.JWTIssuer
+	apiServer.JWTAudience = config.JWTAudience
+	if config.JWTKeyDir != "" {
+		keys, err := api.LoadKeySet(config.JWTKeyDir, config.JWTActiveKeyID)
+		if err != nil {
+			return fmt.Errorf("failed to load jwt keys: %w", err)
+		}
+		apiServer.Keys = keys
+	}
+	apiServer.TOTPKey, err = base64.StdEncoding.DecodeString(config.TOTPEncryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to decode totp encryption key: %w", err)
+	}
+	err = apiServer.EncryptTOTPSecrets(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt totp secrets: %w", err)
+	}
+	apiServer.BaseURL = config.BaseURL
+	apiServer.PasswordResetURL = config.PasswordResetURL
+	apiServer.EmailVerificationURL = config.EmailVerificationURL
+	apiServer.RequireVerifiedEmail = config.RequireVerifiedEmail
+	apiServer.AllowedEmailDomains = config.AllowedEmailDomains
+	apiServer.TrustedProxies = nonEmpty(config.TrustedProxies)
+	apiServer.MaxLoginFailures = config.Login.MaxFailures
+	apiServer.MaxLoginFailuresPerIP = config.Login.MaxFailuresPerIP
+	apiServer.LoginLockoutDuration = config.Login.LockoutDuration
+	apiServer.AccountDeletionGracePeriod = config.AccountDeletion.GracePeriod
+	apiServer.AccountDeletionMode = config.AccountDeletion.Mode
+	apiServer.PasswordHasher = newPasswordHasher(config.PasswordHash)
+	apiServer.PasswordPolicy, err = newPasswordPolicy(config.PasswordPolicy)
+	if err != nil {
+		return fmt.Errorf("failed to set up password policy: %w", err)
+	}
+
+	mail, closeMail, err := newMailer(config.Mail)
+	if err != nil {
+		return fmt.Errorf("failed to set up mailer: %w", err)
+	}
+	//nolint:errcheck
+	defer closeMail()
+	apiServer.Mailer = mail
+
+	if config.OIDC.IssuerURL != "" {
+		apiServer.OIDC, err = newOIDCProvider(ctx, config.OIDC, config.BaseURL)
+		if err != nil {
+			return fmt.Errorf("failed to set up single sign-on: %w", err)
+		}
+	}
+
+	// Accounts whose deletion grace period is over are removed in the background.
+	go apiServer.PurgeDeletedAccounts(ctx, time.Hour)
+
+	handler := apiServer.WireHttpHandler()
 
 	// And finally we start the HTTP server on the configured port.
 	// Define the server with timeouts (Satisfies gosec G114)
@@ -121,9 +259,80 @@ func LoadConfig(cfg *Config) error {
 		return err
 	}
 
+	// We refuse to start with insecure settings rather than finding out in production.
+	err = cfg.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
 	return nil
 }
 
+// newMailer builds the mailer selected by the configuration, the returned func releases its resources.
+func newMailer(config MailConfig) (mailer.Mailer, func() error, error) {
+	noop := func() error { return nil }
+
+	switch config.Driver {
+	case MailDriverSMTP:
+		return mailer.NewSMTPMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.From), noop, nil
+	case MailDriverLog:
+		if config.LogFile == "" {
+			return mailer.NewLogMailer(os.Stdout), noop, nil
+		}
+		f, err := os.OpenFile(filepath.Clean(config.LogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, nil, err
+		}
+		return mailer.NewLogMailer(f), f.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown mail driver %q", config.Driver)
+	}
+}
+
+// newPasswordHasher builds the hasher selected by the configuration, Validate has checked the values.
+func newPasswordHasher(config PasswordHashConfig) api.PasswordHasher {
+	if config.Algorithm == api.PasswordHashArgon2id {
+		return api.Argon2idHasher{
+			Memory:      config.Argon2Memory,
+			Iterations:  config.Argon2Iterations,
+			Parallelism: config.Argon2Parallelism,
+		}
+	}
+	return api.BcryptHasher{Cost: config.BcryptCost}
+}
+
+// newPasswordPolicy builds the policy, opening the breach list when one is configured.
+func newPasswordPolicy(config PasswordPolicyConfig) (*passwordpolicy.Policy, error) {
+	policy := passwordpolicy.New()
+	policy.MinLength = config.MinLength
+	if config.BreachDir != "" {
+		breaches, err := passwordpolicy.NewBreachList(filepath.Clean(config.BreachDir))
+		if err != nil {
+			return nil, err
+		}
+		policy.Breaches = breaches
+	}
+	return policy, nil
+}
+
+// newOIDCProvider fetches the provider's discovery document, the server does not start without it.
+func newOIDCProvider(ctx context.Context, config OIDCConfig, baseURL string) (*oidc.Provider, error) {
+	redirectURL := config.RedirectURL
+	if redirectURL == "" {
+		redirectURL = strings.TrimSuffix(baseURL, "/") + "/oidc/callback"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return oidc.Discover(ctx, oidc.Config{
+		IssuerURL:    config.IssuerURL,
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       nonEmpty(config.Scopes),
+	}, nil)
+}
+
 // getPostgresConnectionURL constructs the PostgreSQL connection URL from the provided configuration.
 func getPostgresConnectionURL(config DBConfig) string {
 	queryValues := url.Values{}
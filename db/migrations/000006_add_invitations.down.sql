@@ -0,0 +1,3 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS fk_invited_by;
+ALTER TABLE users DROP COLUMN IF EXISTS invited_by;
+DROP TABLE IF EXISTS invitations;
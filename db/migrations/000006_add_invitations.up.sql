@@ -0,0 +1,21 @@
+CREATE TABLE invitations (
+    id SERIAL PRIMARY KEY,
+    code_hash VARCHAR UNIQUE NOT NULL,
+    created_by INT NOT NULL,
+    max_uses INT NOT NULL,
+    uses INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    CONSTRAINT fk_created_by
+      FOREIGN KEY(created_by)
+      REFERENCES users(id)
+      ON DELETE CASCADE,
+    CONSTRAINT invitations_uses_check CHECK (uses >= 0 AND uses <= max_uses)
+);
+
+ALTER TABLE users ADD COLUMN invited_by INT;
+ALTER TABLE users ADD CONSTRAINT fk_invited_by
+  FOREIGN KEY(invited_by)
+  REFERENCES users(id)
+  ON DELETE SET NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN role VARCHAR NOT NULL DEFAULT 'member';
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('member', 'moderator', 'admin'));
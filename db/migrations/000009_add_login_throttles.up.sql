@@ -0,0 +1,7 @@
+-- failed logins are counted per key, "account:<email>" or "ip:<address>", whether the account exists or not
+CREATE TABLE login_throttles (
+    key VARCHAR PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    locked_until TIMESTAMPTZ
+);
@@ -0,0 +1,19 @@
+-- Accounts that only differ by case have to be merged by hand, the unique indexes below cannot be built otherwise.
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM users GROUP BY lower(email) HAVING count(*) > 1) THEN
+    RAISE EXCEPTION 'some users share an email that only differs by case, merge them before migrating';
+  END IF;
+  IF EXISTS (SELECT 1 FROM users GROUP BY lower(username) HAVING count(*) > 1) THEN
+    RAISE EXCEPTION 'some users share a username that only differs by case, rename them before migrating';
+  END IF;
+END $$;
+
+-- emails are stored lowercase from now on, usernames keep the case they were chosen with
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_username_key;
+
+CREATE UNIQUE INDEX users_email_lower_key ON users(lower(email));
+CREATE UNIQUE INDEX users_username_lower_key ON users(lower(username));
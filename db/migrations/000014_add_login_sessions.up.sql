@@ -0,0 +1,26 @@
+-- one row per login, shared by every refresh token of its family, so users can see and end their sessions
+CREATE TABLE login_sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    family_id VARCHAR UNIQUE NOT NULL,
+    user_agent VARCHAR NOT NULL DEFAULT '',
+    ip_address VARCHAR NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ,
+
+    CONSTRAINT fk_user
+      FOREIGN KEY(user_id)
+      REFERENCES users(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX login_sessions_user_id_idx ON login_sessions(user_id);
+
+-- logins from before this table existed keep working: their refreshed access tokens name the family
+INSERT INTO login_sessions (user_id, family_id, created_at, last_seen_at)
+SELECT user_id, family_id, min(created_at), max(created_at)
+FROM sessions
+WHERE revoked_at IS NULL
+GROUP BY user_id, family_id
+ON CONFLICT (family_id) DO NOTHING;
@@ -0,0 +1,2 @@
+-- the feed is paged by (created_at, id), newest first
+CREATE INDEX posts_created_at_id_idx ON posts (created_at DESC, id DESC);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS posts_search_idx;
+DROP FUNCTION IF EXISTS post_search_vector(TEXT, TEXT);
@@ -0,0 +1,10 @@
+-- titles weigh more than the body when ranking search results. Queries must call this same function
+-- for the planner to use the index. The vector lives in the index only: stored with every post it
+-- would be read back by every query on posts, and it can be bigger than the content.
+CREATE FUNCTION post_search_vector(title TEXT, content TEXT) RETURNS tsvector
+LANGUAGE SQL IMMUTABLE PARALLEL SAFE
+AS $$
+  SELECT setweight(to_tsvector('english', title), 'A') || setweight(to_tsvector('english', content), 'B')
+$$;
+
+CREATE INDEX posts_search_idx ON posts USING GIN (post_search_vector(title, content));
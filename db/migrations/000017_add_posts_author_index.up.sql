@@ -0,0 +1,2 @@
+-- an author's posts are listed in feed order
+CREATE INDEX posts_user_id_created_at_id_idx ON posts (user_id, created_at DESC, id DESC);
@@ -0,0 +1,31 @@
+CREATE TABLE comments (
+    id SERIAL PRIMARY KEY,
+    post_id INT NOT NULL,
+    user_id INT NOT NULL,
+    -- NULL for a comment on the post itself, otherwise the comment it replies to
+    parent_comment_id INT,
+    content TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    -- lets the parent key below also check the reply is on the same post
+    CONSTRAINT comments_id_post_id_key UNIQUE (id, post_id),
+
+    CONSTRAINT fk_post
+      FOREIGN KEY(post_id)
+      REFERENCES posts(id)
+      ON DELETE CASCADE,
+    CONSTRAINT fk_user
+      FOREIGN KEY(user_id)
+      REFERENCES users(id)
+      ON DELETE CASCADE,
+    -- deleting a comment deletes the replies under it
+    CONSTRAINT fk_parent_comment
+      FOREIGN KEY(parent_comment_id, post_id)
+      REFERENCES comments(id, post_id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX comments_post_id_idx ON comments(post_id);
+CREATE INDEX comments_parent_comment_id_idx ON comments(parent_comment_id);
+CREATE INDEX comments_user_id_idx ON comments(user_id);
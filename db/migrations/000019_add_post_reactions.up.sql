@@ -0,0 +1,21 @@
+-- a user can react to a post once per reaction type
+CREATE TABLE post_reactions (
+    post_id INT NOT NULL,
+    user_id INT NOT NULL,
+    reaction VARCHAR NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (post_id, user_id, reaction),
+    CONSTRAINT post_reactions_reaction_check CHECK (reaction IN ('like', 'love', 'laugh', 'celebrate', 'insightful', 'sad')),
+
+    CONSTRAINT fk_post
+      FOREIGN KEY(post_id)
+      REFERENCES posts(id)
+      ON DELETE CASCADE,
+    CONSTRAINT fk_user
+      FOREIGN KEY(user_id)
+      REFERENCES users(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX post_reactions_user_id_idx ON post_reactions(user_id);
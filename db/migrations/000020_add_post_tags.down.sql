@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS post_reactions_post_id_idx;
+DROP TABLE IF EXISTS post_tags;
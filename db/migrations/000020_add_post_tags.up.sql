@@ -0,0 +1,18 @@
+-- tags are stored lowercase, the feed can be filtered by one
+CREATE TABLE post_tags (
+    post_id INT NOT NULL,
+    tag VARCHAR NOT NULL,
+
+    PRIMARY KEY (post_id, tag),
+    CONSTRAINT post_tags_tag_check CHECK (tag <> '' AND tag = lower(tag)),
+
+    CONSTRAINT fk_post
+      FOREIGN KEY(post_id)
+      REFERENCES posts(id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX post_tags_tag_idx ON post_tags(tag, post_id);
+
+-- the feed sorted by comments or reactions counts them per post
+CREATE INDEX post_reactions_post_id_idx ON post_reactions(post_id);
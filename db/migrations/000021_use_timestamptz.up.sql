@@ -0,0 +1,10 @@
+-- The tables of the initial schema store timestamps without a zone, every later table uses
+-- TIMESTAMPTZ. Times computed in Go are compared with these columns (feed cursors, date filters),
+-- so they only agreed when the app and the database both ran in UTC. Existing values were
+-- written by servers running in UTC.
+ALTER TABLE users
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC';
+
+ALTER TABLE posts
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE 'UTC';
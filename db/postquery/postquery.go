@@ -0,0 +1,159 @@
+// Package postquery builds the post list query at request time. The list takes optional filters
+// and a sort order, which sqlc cannot express without one query per combination, so it lives
+// here and db/repo stays generated. Values only ever reach Postgres as placeholders and the
+// ORDER BY comes from the sorts whitelist, never from the caller.
+package postquery
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/Iknite-Space/sqlc-example-api/db/repo"
+)
+
+// Sort is an order the post list can be read in.
+type Sort string
+
+const (
+	SortNewest        Sort = "newest"
+	SortOldest        Sort = "oldest"
+	SortMostCommented Sort = "most_commented"
+	SortMostReacted   Sort = "most_reacted"
+)
+
+// sortSpec is the SQL of a sort. Ties are broken by id in the same direction so every post
+// has a unique position to page from. The key of a count sort is a count subquery, the posts
+// are positioned by that count instead of their creation time.
+type sortSpec struct {
+	key     string
+	desc    bool
+	byCount bool
+}
+
+var sorts = map[Sort]sortSpec{
+	SortNewest:        {key: "p.created_at", desc: true},
+	SortOldest:        {key: "p.created_at", desc: false},
+	SortMostCommented: {key: "(SELECT count(*) FROM comments c WHERE c.post_id = p.id)", desc: true, byCount: true},
+	SortMostReacted:   {key: "(SELECT count(*) FROM post_reactions r WHERE r.post_id = p.id)", desc: true, byCount: true},
+}
+
+// Valid reports whether the sort is one List accepts.
+func (s Sort) Valid() bool {
+	_, ok := sorts[s]
+	return ok
+}
+
+// Key is the position of a post in the list, the list continues after it. Count is only
+// used by the count sorts, CreatedAt by the others.
+type Key struct {
+	CreatedAt time.Time
+	Count     int64
+	ID        int32
+}
+
+type Params struct {
+	AuthorID    *int32
+	Tag         *string
+	CreatedFrom pgtype.Timestamptz // inclusive
+	CreatedTo   pgtype.Timestamptz // exclusive
+	Sort        Sort
+	After       *Key
+	Limit       int32
+}
+
+const columns = `SELECT p.id, p.title, p.content, p.user_id, p.created_at, p.updated_at`
+
+type Row struct {
+	Post  repo.Post
+	Count int64 // the comments or reactions counted by a count sort, 0 for the others
+}
+
+// Key is the position of the post in the list it was read from.
+func (row Row) Key() Key {
+	return Key{CreatedAt: row.Post.CreatedAt, Count: row.Count, ID: row.Post.ID}
+}
+
+// List reads a page of the post list from db, the pool or a transaction.
+func List(ctx context.Context, db repo.DBTX, arg Params) ([]Row, error) {
+	spec, ok := sorts[arg.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown post sort %q", arg.Sort)
+	}
+
+	var where []string
+	var args []interface{}
+	placeholder := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if arg.AuthorID != nil {
+		where = append(where, "p.user_id = "+placeholder(*arg.AuthorID))
+	}
+	if arg.Tag != nil {
+		where = append(where, "EXISTS (SELECT 1 FROM post_tags t WHERE t.post_id = p.id AND t.tag = "+placeholder(*arg.Tag)+")")
+	}
+	if arg.CreatedFrom.Valid {
+		where = append(where, "p.created_at >= "+placeholder(arg.CreatedFrom))
+	}
+	if arg.CreatedTo.Valid {
+		where = append(where, "p.created_at < "+placeholder(arg.CreatedTo))
+	}
+
+	direction, comparison := "ASC", ">"
+	if spec.desc {
+		direction, comparison = "DESC", "<"
+	}
+	if arg.After != nil {
+		var after interface{} = arg.After.CreatedAt
+		if spec.byCount {
+			after = arg.After.Count
+		}
+		where = append(where, fmt.Sprintf("(%s, p.id) %s (%s, %s)", spec.key, comparison, placeholder(after), placeholder(arg.After.ID)))
+	}
+
+	count := "0::bigint"
+	if spec.byCount {
+		count = spec.key
+	}
+
+	var sql strings.Builder
+	sql.WriteString(columns)
+	fmt.Fprintf(&sql, ", %s AS sort_count FROM posts p", count)
+	if len(where) > 0 {
+		sql.WriteString("\nWHERE ")
+		sql.WriteString(strings.Join(where, "\n  AND "))
+	}
+	fmt.Fprintf(&sql, "\nORDER BY %s %s, p.id %s\nLIMIT %s", spec.key, direction, direction, placeholder(arg.Limit))
+
+	rows, err := db.Query(ctx, sql.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Row{}
+	for rows.Next() {
+		var i Row
+		if err := rows.Scan(
+			&i.Post.ID,
+			&i.Post.Title,
+			&i.Post.Content,
+			&i.Post.UserID,
+			&i.Post.CreatedAt,
+			&i.Post.UpdatedAt,
+			&i.Count,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
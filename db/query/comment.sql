@@ -0,0 +1,44 @@
+-- name: CreateComment :one
+INSERT INTO comments (
+  post_id,
+  user_id,
+  parent_comment_id,
+  content
+) VALUES (
+  $1, $2, $3, $4
+) RETURNING *;
+
+-- name: UpdateComment :one
+UPDATE comments
+SET content = $3, updated_at = now()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteComment :execrows
+DELETE FROM comments
+WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteAnyComment :execrows
+DELETE FROM comments
+WHERE id = $1;
+
+-- name: ListCommentsByPost :many
+WITH RECURSIVE thread AS (
+  SELECT c.id, c.post_id, c.user_id, c.parent_comment_id, c.content, c.created_at, c.updated_at,
+    0 AS depth, ARRAY[c.id] AS path
+  FROM comments c
+  WHERE c.post_id = $1 AND c.parent_comment_id IS NULL
+  UNION ALL
+  SELECT c.id, c.post_id, c.user_id, c.parent_comment_id, c.content, c.created_at, c.updated_at,
+    t.depth + 1, t.path || c.id
+  FROM comments c
+  JOIN thread t ON c.parent_comment_id = t.id
+)
+SELECT id, post_id, user_id, parent_comment_id, content, created_at, updated_at, depth::int AS depth
+FROM thread
+ORDER BY path;
+
+-- name: ListCommentsByUser :many
+SELECT * FROM comments
+WHERE user_id = $1
+ORDER BY created_at DESC;
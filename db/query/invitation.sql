@@ -0,0 +1,24 @@
+-- name: CreateInvitation :one
+INSERT INTO invitations (
+  code_hash,
+  created_by,
+  max_uses,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4
+) RETURNING *;
+
+-- name: GetValidInvitation :one
+SELECT * FROM invitations
+WHERE code_hash = $1 AND uses < max_uses AND expires_at > now()
+LIMIT 1;
+
+-- name: UseInvitation :execrows
+UPDATE invitations
+SET uses = uses + 1
+WHERE id = $1 AND uses < max_uses AND expires_at > now();
+
+-- name: ListInvitationsByCreator :many
+SELECT * FROM invitations
+WHERE created_by = $1
+ORDER BY created_at DESC;
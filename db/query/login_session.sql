@@ -0,0 +1,49 @@
+-- name: CreateLoginSession :exec
+INSERT INTO login_sessions (
+  user_id,
+  family_id,
+  user_agent,
+  ip_address
+) VALUES (
+  $1, $2, $3, $4
+);
+
+-- name: GetLoginSessionByFamily :one
+SELECT * FROM login_sessions
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL
+LIMIT 1;
+
+-- name: TouchLoginSession :one
+UPDATE login_sessions
+SET last_seen_at = now()
+WHERE family_id = $1
+RETURNING revoked_at;
+
+-- name: ListActiveLoginSessions :many
+SELECT * FROM login_sessions
+WHERE user_id = $1 AND revoked_at IS NULL AND EXISTS (
+  SELECT 1 FROM sessions
+  WHERE sessions.family_id = login_sessions.family_id
+    AND sessions.revoked_at IS NULL AND sessions.expires_at > now()
+)
+ORDER BY last_seen_at DESC;
+
+-- name: ListLoginSessionsByUser :many
+SELECT * FROM login_sessions
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: RevokeLoginSession :one
+UPDATE login_sessions
+SET revoked_at = now()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+RETURNING family_id;
+
+-- name: RevokeLoginSessionByFamily :exec
+UPDATE login_sessions
+SET revoked_at = now()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: DeleteUserLoginSessions :exec
+DELETE FROM login_sessions
+WHERE user_id = $1;
@@ -13,16 +13,52 @@ WHERE id = $1 LIMIT 1;
 
 -- name: ListPosts :many
 SELECT * FROM posts
-ORDER BY created_at DESC
+ORDER BY created_at DESC, id DESC
 LIMIT $1
 OFFSET $2;
 
 -- name: UpdatePost :one
 UPDATE posts
-SET title = $2, content = $3, updated_at = now()
-WHERE id = $1
+SET title = $3, content = $4, updated_at = now()
+WHERE id = $1 AND user_id = $2
 RETURNING *;
 
--- name: DeletePost :exec
+-- name: DeletePost :execrows
 DELETE FROM posts
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteAnyPost :execrows
+DELETE FROM posts
+WHERE id = $1;
+
+-- name: ListPostsByUser :many
+SELECT * FROM posts
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: SearchPosts :many
+SELECT
+  p.id,
+  p.title,
+  p.content,
+  p.user_id,
+  p.created_at,
+  p.updated_at,
+  ts_rank(post_search_vector(p.title, p.content), q)::real AS rank,
+  ts_headline(
+    'english',
+    replace(replace(replace(p.content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+    q,
+    'StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2'
+  )::text AS headline
+FROM posts p, websearch_to_tsquery('english', sqlc.arg(query)::text) q
+WHERE post_search_vector(p.title, p.content) @@ q
+  AND (sqlc.narg(author_id)::int IS NULL OR p.user_id = sqlc.narg(author_id)::int)
+  AND (sqlc.narg(created_from)::timestamptz IS NULL OR p.created_at >= sqlc.narg(created_from)::timestamptz)
+  AND (sqlc.narg(created_to)::timestamptz IS NULL OR p.created_at < sqlc.narg(created_to)::timestamptz)
+  AND (
+    sqlc.narg(after_rank)::real IS NULL
+    OR (ts_rank(post_search_vector(p.title, p.content), q), p.id) < (sqlc.narg(after_rank)::real, sqlc.narg(after_id)::int)
+  )
+ORDER BY rank DESC, p.id DESC
+LIMIT sqlc.arg(page_size);
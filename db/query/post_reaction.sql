@@ -0,0 +1,28 @@
+-- name: AddPostReaction :exec
+INSERT INTO post_reactions (
+  post_id,
+  user_id,
+  reaction
+) VALUES (
+  $1, $2, $3
+) ON CONFLICT DO NOTHING;
+
+-- name: RemovePostReaction :exec
+DELETE FROM post_reactions
+WHERE post_id = $1 AND user_id = $2 AND reaction = $3;
+
+-- name: ListPostReactionCounts :many
+SELECT
+  post_id,
+  reaction,
+  count(*)::int AS count,
+  bool_or(user_id = sqlc.arg(user_id)::int)::bool AS reacted
+FROM post_reactions
+WHERE post_id = ANY(sqlc.arg(post_ids)::int[])
+GROUP BY post_id, reaction
+ORDER BY post_id, reaction;
+
+-- name: ListPostReactionsByUser :many
+SELECT * FROM post_reactions
+WHERE user_id = $1
+ORDER BY created_at DESC;
@@ -0,0 +1,13 @@
+-- name: AddPostTags :exec
+INSERT INTO post_tags (post_id, tag)
+SELECT sqlc.arg(post_id)::int, unnest(sqlc.arg(tags)::varchar[])
+ON CONFLICT DO NOTHING;
+
+-- name: DeletePostTags :exec
+DELETE FROM post_tags
+WHERE post_id = $1;
+
+-- name: ListPostTags :many
+SELECT * FROM post_tags
+WHERE post_id = ANY(sqlc.arg(post_ids)::int[])
+ORDER BY post_id, tag;
@@ -0,0 +1,33 @@
+-- name: CreateSession :one
+INSERT INTO sessions (
+  user_id,
+  family_id,
+  refresh_token_hash,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4
+) RETURNING *;
+
+-- name: GetSessionByTokenHash :one
+SELECT * FROM sessions
+WHERE refresh_token_hash = $1 LIMIT 1;
+
+-- name: RevokeSession :execrows
+UPDATE sessions
+SET revoked_at = now()
+WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeSessionFamily :exec
+UPDATE sessions
+SET revoked_at = now()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserSessions :exec
+UPDATE sessions
+SET revoked_at = now()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserSessionsBefore :exec
+UPDATE sessions
+SET revoked_at = now()
+WHERE user_id = $1 AND created_at < $2 AND revoked_at IS NULL;
@@ -0,0 +1,73 @@
+-- name: UpsertTOTPCredential :one
+INSERT INTO totp_credentials (
+  user_id,
+  secret
+) VALUES (
+  $1, $2
+) ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, enabled_at = NULL, last_used_step = 0, created_at = now()
+RETURNING *;
+
+-- name: GetTOTPCredential :one
+SELECT * FROM totp_credentials
+WHERE user_id = $1 LIMIT 1;
+
+-- name: EnableTOTPCredential :exec
+UPDATE totp_credentials
+SET enabled_at = now()
+WHERE user_id = $1;
+
+-- name: UpdateTOTPLastUsedStep :execrows
+UPDATE totp_credentials
+SET last_used_step = $2
+WHERE user_id = $1 AND last_used_step < $2;
+
+-- name: DeleteTOTPCredential :exec
+DELETE FROM totp_credentials
+WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (
+  user_id,
+  code_hash
+) VALUES (
+  $1, $2
+);
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = now()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CreateLoginChallenge :one
+INSERT INTO login_challenges (
+  user_id,
+  token_hash,
+  expires_at
+) VALUES (
+  $1, $2, $3
+) RETURNING *;
+
+-- name: AttemptLoginChallenge :one
+UPDATE login_challenges
+SET attempts = attempts + 1
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now() AND attempts < $2
+RETURNING *;
+
+-- name: UseLoginChallenge :execrows
+UPDATE login_challenges
+SET used_at = now()
+WHERE id = $1 AND used_at IS NULL;
+
+-- name: ListPlaintextTOTPCredentials :many
+SELECT * FROM totp_credentials
+WHERE secret NOT LIKE 'v1:%';
+
+-- name: ReplaceTOTPSecret :execrows
+UPDATE totp_credentials
+SET secret = sqlc.arg(new_secret)
+WHERE user_id = sqlc.arg(user_id) AND secret = sqlc.arg(old_secret);
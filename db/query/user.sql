@@ -1,11 +1,15 @@
 -- name: CreateUser :one
-INSERT INTO users(username, email , hashed_password)
-VALUES ($1, $2, $3)
+INSERT INTO users(username, email , hashed_password, invited_by)
+VALUES ($1, $2, $3, $4)
 RETURNING *;
 
 -- name: GetUseryByEmail :one
 SELECT * FROM users
-WHERE email = $1;
+WHERE lower(email) = lower(sqlc.arg(email));
+
+-- name: GetUserByUsername :one
+SELECT * FROM users
+WHERE lower(username) = lower(sqlc.arg(username));
 
 -- name: UpdateUser :one
 UPDATE users
@@ -17,3 +21,65 @@ RETURNING *;
 DELETE FROM users
 WHERE id = $1;
 
+-- name: GetUser :one
+SELECT * FROM users
+WHERE id = $1 LIMIT 1;
+
+-- name: GetTokensValidAfter :one
+SELECT tokens_valid_after FROM users
+WHERE id = $1 LIMIT 1;
+
+-- name: SetTokensValidAfter :exec
+UPDATE users
+SET tokens_valid_after = $2
+WHERE id = $1;
+
+-- name: MarkUserVerified :exec
+UPDATE users
+SET verified_at = now()
+WHERE id = $1 AND verified_at IS NULL;
+
+-- name: ListUsers :many
+SELECT * FROM users
+ORDER BY id
+LIMIT $1
+OFFSET $2;
+
+-- name: UpdateUserRole :one
+UPDATE users
+SET role = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: ScheduleUserDeletion :one
+UPDATE users
+SET deletion_scheduled_at = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: CancelUserDeletion :execrows
+UPDATE users
+SET deletion_scheduled_at = NULL
+WHERE id = $1 AND deletion_scheduled_at IS NOT NULL;
+
+-- name: ListUsersDueForDeletion :many
+SELECT * FROM users
+WHERE deletion_scheduled_at <= now() AND deleted_at IS NULL
+ORDER BY id
+LIMIT $1;
+
+-- name: AnonymizeUser :exec
+UPDATE users
+SET username = 'deleted-' || id,
+  email = 'deleted-' || id || '@deleted.invalid',
+  hashed_password = '',
+  verified_at = NULL,
+  invited_by = NULL,
+  deletion_scheduled_at = NULL,
+  deleted_at = now()
+WHERE id = $1;
+
+-- name: UpdateUserPasswordHash :exec
+UPDATE users
+SET hashed_password = sqlc.arg(new_hashed_password)
+WHERE id = sqlc.arg(id) AND hashed_password = sqlc.arg(old_hashed_password);
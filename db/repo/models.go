@@ -5,22 +5,173 @@
 package repo
 
 import (
+	"time"
+
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type APIKey struct {
+	ID         int32              `json:"id"`
+	UserID     int32              `json:"user_id"`
+	Name       string             `json:"name"`
+	Prefix     string             `json:"prefix"`
+	SecretHash string             `json:"secret_hash"`
+	Scopes     []string           `json:"scopes"`
+	ExpiresAt  pgtype.Timestamptz `json:"expires_at"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
+	RevokedAt  pgtype.Timestamptz `json:"revoked_at"`
+	CreatedAt  time.Time          `json:"created_at"`
+}
+
+type Comment struct {
+	ID              int32     `json:"id"`
+	PostID          int32     `json:"post_id"`
+	UserID          int32     `json:"user_id"`
+	ParentCommentID *int32    `json:"parent_comment_id"`
+	Content         string    `json:"content"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type EmailVerificationToken struct {
+	ID        int32              `json:"id"`
+	UserID    int32              `json:"user_id"`
+	TokenHash string             `json:"token_hash"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+type Invitation struct {
+	ID        int32     `json:"id"`
+	CodeHash  string    `json:"code_hash"`
+	CreatedBy int32     `json:"created_by"`
+	MaxUses   int32     `json:"max_uses"`
+	Uses      int32     `json:"uses"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LoginChallenge struct {
+	ID        int32              `json:"id"`
+	UserID    int32              `json:"user_id"`
+	TokenHash string             `json:"token_hash"`
+	Attempts  int32              `json:"attempts"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+type LoginSession struct {
+	ID         int32              `json:"id"`
+	UserID     int32              `json:"user_id"`
+	FamilyID   string             `json:"family_id"`
+	UserAgent  string             `json:"user_agent"`
+	IpAddress  string             `json:"ip_address"`
+	CreatedAt  time.Time          `json:"created_at"`
+	LastSeenAt time.Time          `json:"last_seen_at"`
+	RevokedAt  pgtype.Timestamptz `json:"revoked_at"`
+}
+
+type LoginThrottle struct {
+	Key           string             `json:"key"`
+	Failures      int32              `json:"failures"`
+	LastFailureAt time.Time          `json:"last_failure_at"`
+	LockedUntil   pgtype.Timestamptz `json:"locked_until"`
+}
+
+type OIDCAuthRequest struct {
+	ID           int32     `json:"id"`
+	StateHash    string    `json:"state_hash"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"code_verifier"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type PasswordResetToken struct {
+	ID        int32              `json:"id"`
+	UserID    int32              `json:"user_id"`
+	TokenHash string             `json:"token_hash"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
 type Post struct {
-	ID        int32            `json:"id"`
-	Title     string           `json:"title"`
-	Content   string           `json:"content"`
-	UserID    int32            `json:"user_id"`
-	CreatedAt pgtype.Timestamp `json:"created_at"`
-	UpdatedAt pgtype.Timestamp `json:"updated_at"`
+	ID        int32     `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	UserID    int32     `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PostReaction struct {
+	PostID    int32     `json:"post_id"`
+	UserID    int32     `json:"user_id"`
+	Reaction  string    `json:"reaction"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PostTag struct {
+	PostID int32  `json:"post_id"`
+	Tag    string `json:"tag"`
+}
+
+type RecoveryCode struct {
+	ID        int32              `json:"id"`
+	UserID    int32              `json:"user_id"`
+	CodeHash  string             `json:"code_hash"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+type RevokedToken struct {
+	Jti       string    `json:"jti"`
+	UserID    int32     `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+type Session struct {
+	ID               int32              `json:"id"`
+	UserID           int32              `json:"user_id"`
+	FamilyID         string             `json:"family_id"`
+	RefreshTokenHash string             `json:"refresh_token_hash"`
+	ExpiresAt        time.Time          `json:"expires_at"`
+	RevokedAt        pgtype.Timestamptz `json:"revoked_at"`
+	CreatedAt        time.Time          `json:"created_at"`
+}
+
+type TotpCredential struct {
+	UserID       int32              `json:"user_id"`
+	Secret       string             `json:"secret"`
+	EnabledAt    pgtype.Timestamptz `json:"enabled_at"`
+	LastUsedStep int64              `json:"last_used_step"`
+	CreatedAt    time.Time          `json:"created_at"`
 }
 
 type User struct {
-	ID             int32            `json:"id"`
-	Username       string           `json:"username"`
-	Email          string           `json:"email"`
-	HashedPassword string           `json:"hashed_password"`
-	CreatedAt      pgtype.Timestamp `json:"created_at"`
+	ID                  int32              `json:"id"`
+	Username            string             `json:"username"`
+	Email               string             `json:"email"`
+	HashedPassword      string             `json:"hashed_password"`
+	CreatedAt           time.Time          `json:"created_at"`
+	TokensValidAfter    pgtype.Timestamptz `json:"tokens_valid_after"`
+	VerifiedAt          pgtype.Timestamptz `json:"verified_at"`
+	InvitedBy           *int32             `json:"invited_by"`
+	Role                string             `json:"role"`
+	DeletionScheduledAt pgtype.Timestamptz `json:"deletion_scheduled_at"`
+	DeletedAt           pgtype.Timestamptz `json:"deleted_at"`
+}
+
+type UserIdentity struct {
+	ID          int32     `json:"id"`
+	UserID      int32     `json:"user_id"`
+	Issuer      string    `json:"issuer"`
+	Subject     string    `json:"subject"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
 }
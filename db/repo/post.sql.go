@@ -7,6 +7,9 @@ package repo
 
 import (
 	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const createPost = `-- name: CreatePost :one
@@ -39,14 +42,35 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 	return i, err
 }
 
-const deletePost = `-- name: DeletePost :exec
+const deleteAnyPost = `-- name: DeleteAnyPost :execrows
 DELETE FROM posts
 WHERE id = $1
 `
 
-func (q *Queries) DeletePost(ctx context.Context, id int32) error {
-	_, err := q.db.Exec(ctx, deletePost, id)
-	return err
+func (q *Queries) DeleteAnyPost(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteAnyPost, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deletePost = `-- name: DeletePost :execrows
+DELETE FROM posts
+WHERE id = $1 AND user_id = $2
+`
+
+type DeletePostParams struct {
+	ID     int32 `json:"id"`
+	UserID int32 `json:"user_id"`
+}
+
+func (q *Queries) DeletePost(ctx context.Context, arg DeletePostParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deletePost, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
 const getPost = `-- name: GetPost :one
@@ -70,7 +94,7 @@ func (q *Queries) GetPost(ctx context.Context, id int32) (Post, error) {
 
 const listPosts = `-- name: ListPosts :many
 SELECT id, title, content, user_id, created_at, updated_at FROM posts
-ORDER BY created_at DESC
+ORDER BY created_at DESC, id DESC
 LIMIT $1
 OFFSET $2
 `
@@ -107,21 +131,146 @@ func (q *Queries) ListPosts(ctx context.Context, arg ListPostsParams) ([]Post, e
 	return items, nil
 }
 
+const listPostsByUser = `-- name: ListPostsByUser :many
+SELECT id, title, content, user_id, created_at, updated_at FROM posts
+WHERE user_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListPostsByUser(ctx context.Context, userID int32) ([]Post, error) {
+	rows, err := q.db.Query(ctx, listPostsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Post{}
+	for rows.Next() {
+		var i Post
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Content,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchPosts = `-- name: SearchPosts :many
+SELECT
+  p.id,
+  p.title,
+  p.content,
+  p.user_id,
+  p.created_at,
+  p.updated_at,
+  ts_rank(post_search_vector(p.title, p.content), q)::real AS rank,
+  ts_headline(
+    'english',
+    replace(replace(replace(p.content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+    q,
+    'StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2'
+  )::text AS headline
+FROM posts p, websearch_to_tsquery('english', $1::text) q
+WHERE post_search_vector(p.title, p.content) @@ q
+  AND ($2::int IS NULL OR p.user_id = $2::int)
+  AND ($3::timestamptz IS NULL OR p.created_at >= $3::timestamptz)
+  AND ($4::timestamptz IS NULL OR p.created_at < $4::timestamptz)
+  AND (
+    $5::real IS NULL
+    OR (ts_rank(post_search_vector(p.title, p.content), q), p.id) < ($5::real, $6::int)
+  )
+ORDER BY rank DESC, p.id DESC
+LIMIT $7
+`
+
+type SearchPostsParams struct {
+	Query       string             `json:"query"`
+	AuthorID    *int32             `json:"author_id"`
+	CreatedFrom pgtype.Timestamptz `json:"created_from"`
+	CreatedTo   pgtype.Timestamptz `json:"created_to"`
+	AfterRank   *float32           `json:"after_rank"`
+	AfterID     *int32             `json:"after_id"`
+	PageSize    int32              `json:"page_size"`
+}
+
+type SearchPostsRow struct {
+	ID        int32     `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	UserID    int32     `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Rank      float32   `json:"rank"`
+	Headline  string    `json:"headline"`
+}
+
+func (q *Queries) SearchPosts(ctx context.Context, arg SearchPostsParams) ([]SearchPostsRow, error) {
+	rows, err := q.db.Query(ctx, searchPosts,
+		arg.Query,
+		arg.AuthorID,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.AfterRank,
+		arg.AfterID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SearchPostsRow{}
+	for rows.Next() {
+		var i SearchPostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Content,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Rank,
+			&i.Headline,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const updatePost = `-- name: UpdatePost :one
 UPDATE posts
-SET title = $2, content = $3, updated_at = now()
-WHERE id = $1
+SET title = $3, content = $4, updated_at = now()
+WHERE id = $1 AND user_id = $2
 RETURNING id, title, content, user_id, created_at, updated_at
 `
 
 type UpdatePostParams struct {
 	ID      int32  `json:"id"`
+	UserID  int32  `json:"user_id"`
 	Title   string `json:"title"`
 	Content string `json:"content"`
 }
 
 func (q *Queries) UpdatePost(ctx context.Context, arg UpdatePostParams) (Post, error) {
-	row := q.db.QueryRow(ctx, updatePost, arg.ID, arg.Title, arg.Content)
+	row := q.db.QueryRow(ctx, updatePost,
+		arg.ID,
+		arg.UserID,
+		arg.Title,
+		arg.Content,
+	)
 	var i Post
 	err := row.Scan(
 		&i.ID,
@@ -6,18 +6,109 @@ package repo
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Querier interface {
+	AddPostReaction(ctx context.Context, arg AddPostReactionParams) error
+	AddPostTags(ctx context.Context, arg AddPostTagsParams) error
+	AnonymizeUser(ctx context.Context, id int32) error
+	AttemptLoginChallenge(ctx context.Context, arg AttemptLoginChallengeParams) (LoginChallenge, error)
+	CancelUserDeletion(ctx context.Context, id int32) (int64, error)
+	CountActiveAPIKeys(ctx context.Context, userID int32) (int64, error)
+	CountEmailVerificationTokensSince(ctx context.Context, arg CountEmailVerificationTokensSinceParams) (int64, error)
+	CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (APIKey, error)
+	CreateComment(ctx context.Context, arg CreateCommentParams) (Comment, error)
+	CreateEmailVerificationToken(ctx context.Context, arg CreateEmailVerificationTokenParams) (EmailVerificationToken, error)
+	CreateInvitation(ctx context.Context, arg CreateInvitationParams) (Invitation, error)
+	CreateLoginChallenge(ctx context.Context, arg CreateLoginChallengeParams) (LoginChallenge, error)
+	CreateLoginSession(ctx context.Context, arg CreateLoginSessionParams) error
+	CreateOIDCAuthRequest(ctx context.Context, arg CreateOIDCAuthRequestParams) error
+	CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) (PasswordResetToken, error)
 	CreatePost(ctx context.Context, arg CreatePostParams) (Post, error)
+	CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error
+	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
-	DeletePost(ctx context.Context, id int32) error
+	CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (UserIdentity, error)
+	DeleteAnyComment(ctx context.Context, id int32) (int64, error)
+	DeleteAnyPost(ctx context.Context, id int32) (int64, error)
+	DeleteComment(ctx context.Context, arg DeleteCommentParams) (int64, error)
+	DeleteExpiredOIDCAuthRequests(ctx context.Context) error
+	DeleteExpiredRevokedTokens(ctx context.Context) error
+	DeleteLoginThrottle(ctx context.Context, key string) error
+	DeletePost(ctx context.Context, arg DeletePostParams) (int64, error)
+	DeletePostTags(ctx context.Context, postID int32) error
+	DeleteRecoveryCodes(ctx context.Context, userID int32) error
+	DeleteTOTPCredential(ctx context.Context, userID int32) error
 	DeleteUser(ctx context.Context, id int32) error
+	DeleteUserIdentities(ctx context.Context, userID int32) error
+	DeleteUserLoginSessions(ctx context.Context, userID int32) error
+	EnableTOTPCredential(ctx context.Context, userID int32) error
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (APIKey, error)
+	GetLoginSessionByFamily(ctx context.Context, arg GetLoginSessionByFamilyParams) (LoginSession, error)
+	GetLoginThrottle(ctx context.Context, key string) (LoginThrottle, error)
 	GetPost(ctx context.Context, id int32) (Post, error)
+	GetSessionByTokenHash(ctx context.Context, refreshTokenHash string) (Session, error)
+	GetTOTPCredential(ctx context.Context, userID int32) (TotpCredential, error)
+	GetTokensValidAfter(ctx context.Context, id int32) (pgtype.Timestamptz, error)
+	GetUser(ctx context.Context, id int32) (User, error)
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+	GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentity, error)
 	GetUseryByEmail(ctx context.Context, email string) (User, error)
+	GetValidInvitation(ctx context.Context, codeHash string) (Invitation, error)
+	GetValidPasswordResetToken(ctx context.Context, tokenHash string) (PasswordResetToken, error)
+	InvalidateUserEmailVerificationTokens(ctx context.Context, userID int32) error
+	InvalidateUserPasswordResetTokens(ctx context.Context, userID int32) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	ListAPIKeysByUser(ctx context.Context, userID int32) ([]APIKey, error)
+	ListActiveLoginSessions(ctx context.Context, userID int32) ([]LoginSession, error)
+	ListCommentsByPost(ctx context.Context, postID int32) ([]ListCommentsByPostRow, error)
+	ListCommentsByUser(ctx context.Context, userID int32) ([]Comment, error)
+	ListInvitationsByCreator(ctx context.Context, createdBy int32) ([]Invitation, error)
+	ListLoginSessionsByUser(ctx context.Context, userID int32) ([]LoginSession, error)
+	ListPlaintextTOTPCredentials(ctx context.Context) ([]TotpCredential, error)
+	ListPostReactionCounts(ctx context.Context, arg ListPostReactionCountsParams) ([]ListPostReactionCountsRow, error)
+	ListPostReactionsByUser(ctx context.Context, userID int32) ([]PostReaction, error)
+	ListPostTags(ctx context.Context, postIds []int32) ([]PostTag, error)
 	ListPosts(ctx context.Context, arg ListPostsParams) ([]Post, error)
+	ListPostsByUser(ctx context.Context, userID int32) ([]Post, error)
+	ListUserIdentitiesByUser(ctx context.Context, userID int32) ([]UserIdentity, error)
+	ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error)
+	ListUsersDueForDeletion(ctx context.Context, limit int32) ([]User, error)
+	LockLoginThrottle(ctx context.Context, arg LockLoginThrottleParams) error
+	MarkUserVerified(ctx context.Context, id int32) error
+	RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (LoginThrottle, error)
+	RemovePostReaction(ctx context.Context, arg RemovePostReactionParams) error
+	ReplaceTOTPSecret(ctx context.Context, arg ReplaceTOTPSecretParams) (int64, error)
+	RevokeAPIKey(ctx context.Context, arg RevokeAPIKeyParams) (int64, error)
+	RevokeLoginSession(ctx context.Context, arg RevokeLoginSessionParams) (string, error)
+	RevokeLoginSessionByFamily(ctx context.Context, familyID string) error
+	RevokeSession(ctx context.Context, id int32) (int64, error)
+	RevokeSessionFamily(ctx context.Context, familyID string) error
+	RevokeToken(ctx context.Context, arg RevokeTokenParams) error
+	RevokeUserAPIKeys(ctx context.Context, userID int32) error
+	RevokeUserSessions(ctx context.Context, userID int32) error
+	RevokeUserSessionsBefore(ctx context.Context, arg RevokeUserSessionsBeforeParams) error
+	ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (User, error)
+	SearchPosts(ctx context.Context, arg SearchPostsParams) ([]SearchPostsRow, error)
+	SetTokensValidAfter(ctx context.Context, arg SetTokensValidAfterParams) error
+	TakeOIDCAuthRequest(ctx context.Context, stateHash string) (OIDCAuthRequest, error)
+	TouchAPIKey(ctx context.Context, id int32) error
+	TouchLoginSession(ctx context.Context, familyID string) (pgtype.Timestamptz, error)
+	TouchUserIdentity(ctx context.Context, arg TouchUserIdentityParams) error
+	UpdateComment(ctx context.Context, arg UpdateCommentParams) (Comment, error)
 	UpdatePost(ctx context.Context, arg UpdatePostParams) (Post, error)
+	UpdateTOTPLastUsedStep(ctx context.Context, arg UpdateTOTPLastUsedStepParams) (int64, error)
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
+	UpdateUserPasswordHash(ctx context.Context, arg UpdateUserPasswordHashParams) error
+	UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error)
+	UpsertTOTPCredential(ctx context.Context, arg UpsertTOTPCredentialParams) (TotpCredential, error)
+	UseEmailVerificationToken(ctx context.Context, tokenHash string) (EmailVerificationToken, error)
+	UseInvitation(ctx context.Context, id int32) (int64, error)
+	UseLoginChallenge(ctx context.Context, id int32) (int64, error)
+	UsePasswordResetToken(ctx context.Context, tokenHash string) (PasswordResetToken, error)
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -7,22 +7,61 @@ package repo
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const anonymizeUser = `-- name: AnonymizeUser :exec
+UPDATE users
+SET username = 'deleted-' || id,
+  email = 'deleted-' || id || '@deleted.invalid',
+  hashed_password = '',
+  verified_at = NULL,
+  invited_by = NULL,
+  deletion_scheduled_at = NULL,
+  deleted_at = now()
+WHERE id = $1
+`
+
+func (q *Queries) AnonymizeUser(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, anonymizeUser, id)
+	return err
+}
+
+const cancelUserDeletion = `-- name: CancelUserDeletion :execrows
+UPDATE users
+SET deletion_scheduled_at = NULL
+WHERE id = $1 AND deletion_scheduled_at IS NOT NULL
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, cancelUserDeletion, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const createUser = `-- name: CreateUser :one
-INSERT INTO users(username, email , hashed_password)
-VALUES ($1, $2, $3)
-RETURNING id, username, email, hashed_password, created_at
+INSERT INTO users(username, email , hashed_password, invited_by)
+VALUES ($1, $2, $3, $4)
+RETURNING id, username, email, hashed_password, created_at, tokens_valid_after, verified_at, invited_by, role, deletion_scheduled_at, deleted_at
 `
 
 type CreateUserParams struct {
 	Username       string `json:"username"`
 	Email          string `json:"email"`
 	HashedPassword string `json:"hashed_password"`
+	InvitedBy      *int32 `json:"invited_by"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRow(ctx, createUser, arg.Username, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRow(ctx, createUser,
+		arg.Username,
+		arg.Email,
+		arg.HashedPassword,
+		arg.InvitedBy,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -30,6 +69,12 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.CreatedAt,
+		&i.TokensValidAfter,
+		&i.VerifiedAt,
+		&i.InvitedBy,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -44,9 +89,69 @@ func (q *Queries) DeleteUser(ctx context.Context, id int32) error {
 	return err
 }
 
+const getTokensValidAfter = `-- name: GetTokensValidAfter :one
+SELECT tokens_valid_after FROM users
+WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetTokensValidAfter(ctx context.Context, id int32) (pgtype.Timestamptz, error) {
+	row := q.db.QueryRow(ctx, getTokensValidAfter, id)
+	var tokens_valid_after pgtype.Timestamptz
+	err := row.Scan(&tokens_valid_after)
+	return tokens_valid_after, err
+}
+
+const getUser = `-- name: GetUser :one
+SELECT id, username, email, hashed_password, created_at, tokens_valid_after, verified_at, invited_by, role, deletion_scheduled_at, deleted_at FROM users
+WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetUser(ctx context.Context, id int32) (User, error) {
+	row := q.db.QueryRow(ctx, getUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.HashedPassword,
+		&i.CreatedAt,
+		&i.TokensValidAfter,
+		&i.VerifiedAt,
+		&i.InvitedBy,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getUserByUsername = `-- name: GetUserByUsername :one
+SELECT id, username, email, hashed_password, created_at, tokens_valid_after, verified_at, invited_by, role, deletion_scheduled_at, deleted_at FROM users
+WHERE lower(username) = lower($1)
+`
+
+func (q *Queries) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByUsername, username)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.HashedPassword,
+		&i.CreatedAt,
+		&i.TokensValidAfter,
+		&i.VerifiedAt,
+		&i.InvitedBy,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
 const getUseryByEmail = `-- name: GetUseryByEmail :one
-SELECT id, username, email, hashed_password, created_at FROM users
-WHERE email = $1
+SELECT id, username, email, hashed_password, created_at, tokens_valid_after, verified_at, invited_by, role, deletion_scheduled_at, deleted_at FROM users
+WHERE lower(email) = lower($1)
 `
 
 func (q *Queries) GetUseryByEmail(ctx context.Context, email string) (User, error) {
@@ -58,15 +163,162 @@ func (q *Queries) GetUseryByEmail(ctx context.Context, email string) (User, erro
 		&i.Email,
 		&i.HashedPassword,
 		&i.CreatedAt,
+		&i.TokensValidAfter,
+		&i.VerifiedAt,
+		&i.InvitedBy,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
+const listUsers = `-- name: ListUsers :many
+SELECT id, username, email, hashed_password, created_at, tokens_valid_after, verified_at, invited_by, role, deletion_scheduled_at, deleted_at FROM users
+ORDER BY id
+LIMIT $1
+OFFSET $2
+`
+
+type ListUsersParams struct {
+	Limit  int32 `json:"limit"`
+	Offset int32 `json:"offset"`
+}
+
+func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error) {
+	rows, err := q.db.Query(ctx, listUsers, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []User{}
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Email,
+			&i.HashedPassword,
+			&i.CreatedAt,
+			&i.TokensValidAfter,
+			&i.VerifiedAt,
+			&i.InvitedBy,
+			&i.Role,
+			&i.DeletionScheduledAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsersDueForDeletion = `-- name: ListUsersDueForDeletion :many
+SELECT id, username, email, hashed_password, created_at, tokens_valid_after, verified_at, invited_by, role, deletion_scheduled_at, deleted_at FROM users
+WHERE deletion_scheduled_at <= now() AND deleted_at IS NULL
+ORDER BY id
+LIMIT $1
+`
+
+func (q *Queries) ListUsersDueForDeletion(ctx context.Context, limit int32) ([]User, error) {
+	rows, err := q.db.Query(ctx, listUsersDueForDeletion, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []User{}
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Email,
+			&i.HashedPassword,
+			&i.CreatedAt,
+			&i.TokensValidAfter,
+			&i.VerifiedAt,
+			&i.InvitedBy,
+			&i.Role,
+			&i.DeletionScheduledAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markUserVerified = `-- name: MarkUserVerified :exec
+UPDATE users
+SET verified_at = now()
+WHERE id = $1 AND verified_at IS NULL
+`
+
+func (q *Queries) MarkUserVerified(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, markUserVerified, id)
+	return err
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
+UPDATE users
+SET deletion_scheduled_at = $2
+WHERE id = $1
+RETURNING id, username, email, hashed_password, created_at, tokens_valid_after, verified_at, invited_by, role, deletion_scheduled_at, deleted_at
+`
+
+type ScheduleUserDeletionParams struct {
+	ID                  int32              `json:"id"`
+	DeletionScheduledAt pgtype.Timestamptz `json:"deletion_scheduled_at"`
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (User, error) {
+	row := q.db.QueryRow(ctx, scheduleUserDeletion, arg.ID, arg.DeletionScheduledAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.HashedPassword,
+		&i.CreatedAt,
+		&i.TokensValidAfter,
+		&i.VerifiedAt,
+		&i.InvitedBy,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const setTokensValidAfter = `-- name: SetTokensValidAfter :exec
+UPDATE users
+SET tokens_valid_after = $2
+WHERE id = $1
+`
+
+type SetTokensValidAfterParams struct {
+	ID               int32              `json:"id"`
+	TokensValidAfter pgtype.Timestamptz `json:"tokens_valid_after"`
+}
+
+func (q *Queries) SetTokensValidAfter(ctx context.Context, arg SetTokensValidAfterParams) error {
+	_, err := q.db.Exec(ctx, setTokensValidAfter, arg.ID, arg.TokensValidAfter)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET username = $2 , hashed_password = $3
 WHERE id = $1
-RETURNING id, username, email, hashed_password, created_at
+RETURNING id, username, email, hashed_password, created_at, tokens_valid_after, verified_at, invited_by, role, deletion_scheduled_at, deleted_at
 `
 
 type UpdateUserParams struct {
@@ -84,6 +336,60 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.CreatedAt,
+		&i.TokensValidAfter,
+		&i.VerifiedAt,
+		&i.InvitedBy,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const updateUserPasswordHash = `-- name: UpdateUserPasswordHash :exec
+UPDATE users
+SET hashed_password = $1
+WHERE id = $2 AND hashed_password = $3
+`
+
+type UpdateUserPasswordHashParams struct {
+	NewHashedPassword string `json:"new_hashed_password"`
+	ID                int32  `json:"id"`
+	OldHashedPassword string `json:"old_hashed_password"`
+}
+
+func (q *Queries) UpdateUserPasswordHash(ctx context.Context, arg UpdateUserPasswordHashParams) error {
+	_, err := q.db.Exec(ctx, updateUserPasswordHash, arg.NewHashedPassword, arg.ID, arg.OldHashedPassword)
+	return err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :one
+UPDATE users
+SET role = $2
+WHERE id = $1
+RETURNING id, username, email, hashed_password, created_at, tokens_valid_after, verified_at, invited_by, role, deletion_scheduled_at, deleted_at
+`
+
+type UpdateUserRoleParams struct {
+	ID   int32  `json:"id"`
+	Role string `json:"role"`
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.HashedPassword,
+		&i.CreatedAt,
+		&i.TokensValidAfter,
+		&i.VerifiedAt,
+		&i.InvitedBy,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
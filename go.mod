@@ -4,12 +4,16 @@ go 1.23.3
 
 require (
 	github.com/ardanlabs/conf/v3 v3.4.0
+	github.com/coreos/go-oidc/v3 v3.14.1
 	github.com/gin-gonic/gin v1.10.0
 	github.com/golang-migrate/migrate/v4 v4.18.2
 	github.com/jackc/pgx/v5 v5.7.4
 	github.com/joho/godotenv v1.5.1
+	golang.org/x/oauth2 v0.28.0
 )
 
+require github.com/go-jose/go-jose/v4 v4.0.5 // indirect
+
 require (
 	github.com/bytedance/sonic v1.11.6 // indirect
 	github.com/bytedance/sonic/loader v0.1.1 // indirect
@@ -0,0 +1,30 @@
+// Package mailer sends the transactional emails of the application (password resets, verification links...).
+package mailer
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages. Handlers only depend on this interface so the transport can be swapped per environment.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var ErrInvalidHeader = errors.New("mail header must not contain line breaks")
+
+// validate rejects header values that could be used to inject extra headers.
+func (msg Message) validate() error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return ErrInvalidHeader
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// Package oidc is the OpenID Connect relying party of the API: discovery, the authorization code flow
+// with PKCE and ID token verification. It adapts go-oidc and x/oauth2 to the few calls the login needs.
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrInvalidIDToken = errors.New("id token is invalid")
+	ErrNonceMismatch  = errors.New("id token nonce does not match")
+)
+
+// supportedAlgorithms are the ID token signatures we accept, never "none" or HMAC.
+var supportedAlgorithms = []string{
+	gooidc.RS256, gooidc.RS384, gooidc.RS512,
+	gooidc.ES256, gooidc.ES384, gooidc.ES512,
+	gooidc.EdDSA,
+}
+
+// issuedAtLeeway is how far in the future an ID token can be issued, for clocks that drift apart.
+const issuedAtLeeway = time.Minute
+
+// Config describes the client registered at the identity provider.
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string // empty for public clients, the code verifier is then the only proof
+	RedirectURL  string
+	Scopes       []string // "openid" is always requested
+}
+
+// Provider talks to one identity provider.
+type Provider struct {
+	issuer   string
+	oauth2   oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+	client   *http.Client
+}
+
+// IDTokenClaims are the claims of a verified ID token.
+type IDTokenClaims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// Discover reads the provider's discovery document and checks it belongs to the configured issuer.
+func Discover(ctx context.Context, config Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	// the keys are fetched later with the same client, go-oidc takes it from the context
+	provider, err := gooidc.NewProvider(gooidc.ClientContext(ctx, client), config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	var metadata struct {
+		Issuer string `json:"issuer"`
+	}
+	if err := provider.Claims(&metadata); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+
+	scopes := []string{gooidc.ScopeOpenID}
+	for _, scope := range config.Scopes {
+		if scope != "" && scope != gooidc.ScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+	endpoint := provider.Endpoint()
+	// client_secret_basic for confidential clients, a public client only sends its id in the form
+	endpoint.AuthStyle = oauth2.AuthStyleInHeader
+	if config.ClientSecret == "" {
+		endpoint.AuthStyle = oauth2.AuthStyleInParams
+	}
+
+	return &Provider{
+		issuer: metadata.Issuer,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Endpoint:     endpoint,
+			RedirectURL:  config.RedirectURL,
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&gooidc.Config{
+			ClientID:             config.ClientID,
+			SupportedSigningAlgs: supportedAlgorithms,
+		}),
+		client: client,
+	}, nil
+}
+
+// Issuer is the issuer identifier as published by the provider, stored with the identities it vouches for.
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// NewPKCE returns a random code verifier and its S256 challenge (RFC 7636).
+func NewPKCE() (verifier string, challenge string, err error) {
+	verifier = oauth2.GenerateVerifier()
+	return verifier, oauth2.S256ChallengeFromVerifier(verifier), nil
+}
+
+// AuthCodeURL is where the user is sent to log in.
+func (p *Provider) AuthCodeURL(state string, nonce string, codeChallenge string) string {
+	return p.oauth2.AuthCodeURL(state,
+		gooidc.Nonce(nonce),
+		oauth2.SetAuthURLParam("code_challenge", codeChallenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+}
+
+// Exchange trades the authorization code for tokens and returns the verified ID token claims.
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (*IDTokenClaims, error) {
+	token, err := p.oauth2.Exchange(context.WithValue(ctx, oauth2.HTTPClient, p.client), code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("oidc token exchange: no id_token in response")
+	}
+
+	return p.VerifyIDToken(ctx, rawIDToken, nonce)
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken string, nonce string) (*IDTokenClaims, error) {
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	// go-oidc leaves iat to the caller
+	if idToken.IssuedAt.After(time.Now().Add(issuedAtLeeway)) {
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	}
+	if idToken.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+
+	claims := &IDTokenClaims{}
+	if err := idToken.Claims(claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,213 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/Iknite-Space/sqlc-example-api/oidc/oidctest"
+)
+
+const testRedirectURL = "http://app.example.com/oidc/callback"
+
+func discover(t *testing.T, idp *oidctest.Provider) *Provider {
+	t.Helper()
+	provider, err := Discover(context.Background(), Config{
+		IssuerURL:    idp.URL,
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, idp.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+// authorize sends the browser to the provider and returns the code it comes back with.
+func authorize(t *testing.T, idp *oidctest.Provider, provider *Provider, nonce string, challenge string) string {
+	t.Helper()
+	client := idp.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	resp, err := client.Get(provider.AuthCodeURL("state", nonce, challenge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization endpoint answered %s", resp.Status)
+	}
+
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := back.Scheme + "://" + back.Host + back.Path; got != testRedirectURL {
+		t.Fatalf("redirected to %s, want %s", got, testRedirectURL)
+	}
+	if back.Query().Get("state") != "state" {
+		t.Fatalf("state = %q, want it sent back", back.Query().Get("state"))
+	}
+	return back.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	for name, secret := range map[string]string{"confidential client": "s3cret:with/odd&chars", "public client": ""} {
+		t.Run(name, func(t *testing.T) {
+			idp := oidctest.NewProvider("app", secret)
+			defer idp.Close()
+			idp.Claims["sub"] = "248289761001"
+			idp.Claims["email"] = "jane@example.com"
+			idp.Claims["email_verified"] = true
+			provider := discover(t, idp)
+
+			verifier, challenge, err := NewPKCE()
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := authorize(t, idp, provider, "nonce", challenge)
+
+			claims, err := provider.Exchange(context.Background(), code, verifier, "nonce")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "248289761001" || claims.Email != "jane@example.com" || !claims.EmailVerified {
+				t.Errorf("claims = %+v", claims)
+			}
+			if provider.Issuer() != idp.URL {
+				t.Errorf("Issuer() = %q, want %q", provider.Issuer(), idp.URL)
+			}
+
+			// a code works once
+			if _, err := provider.Exchange(context.Background(), code, verifier, "nonce"); err == nil {
+				t.Error("a code was redeemed twice")
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	idp := oidctest.NewProvider("app", "secret")
+	defer idp.Close()
+	idp.Claims["sub"] = "248289761001"
+	provider := discover(t, idp)
+
+	_, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherVerifier, _, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := authorize(t, idp, provider, "nonce", challenge)
+
+	if _, err := provider.Exchange(context.Background(), code, otherVerifier, "nonce"); err == nil {
+		t.Error("the code was exchanged with another verifier")
+	}
+}
+
+func TestExchangeRejectsNonceOfAnotherLogin(t *testing.T) {
+	idp := oidctest.NewProvider("app", "secret")
+	defer idp.Close()
+	idp.Claims["sub"] = "248289761001"
+	provider := discover(t, idp)
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := authorize(t, idp, provider, "nonce of another login", challenge)
+
+	if _, err := provider.Exchange(context.Background(), code, verifier, "nonce"); !errors.Is(err, ErrNonceMismatch) {
+		t.Errorf("err = %v, want ErrNonceMismatch", err)
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	idp := oidctest.NewProvider("app", "secret")
+	defer idp.Close()
+	idp.Claims["sub"] = "248289761001"
+	provider := discover(t, idp)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	with := func(name string, value interface{}) jwt.MapClaims {
+		claims := idp.IDTokenClaims("nonce")
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		idToken string
+		want    error
+	}{
+		{name: "other nonce", idToken: idp.Sign(with("nonce", "other")), want: ErrNonceMismatch},
+		{name: "no nonce", idToken: idp.Sign(with("nonce", nil)), want: ErrNonceMismatch},
+		{name: "other audience", idToken: idp.Sign(with("aud", "another-app")), want: ErrInvalidIDToken},
+		{name: "other issuer", idToken: idp.Sign(with("iss", "https://evil.example.com")), want: ErrInvalidIDToken},
+		{name: "expired", idToken: idp.Sign(with("exp", time.Now().Add(-time.Hour).Unix())), want: ErrInvalidIDToken},
+		{name: "no expiry", idToken: idp.Sign(with("exp", nil)), want: ErrInvalidIDToken},
+		{name: "issued in the future", idToken: idp.Sign(with("iat", time.Now().Add(time.Hour).Unix())), want: ErrInvalidIDToken},
+		{name: "no subject", idToken: idp.Sign(with("sub", nil)), want: ErrInvalidIDToken},
+		{name: "signed by another key", idToken: sign(t, jwt.SigningMethodRS256, otherKey, oidctest.KeyID, with("nonce", "nonce")), want: ErrInvalidIDToken},
+		{name: "unknown kid", idToken: sign(t, jwt.SigningMethodRS256, idp.Key(), "other-key", with("nonce", "nonce")), want: ErrInvalidIDToken},
+		{name: "alg none", idToken: sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, oidctest.KeyID, with("nonce", "nonce")), want: ErrInvalidIDToken},
+		// the public key is no secret, a token MACed with it must not pass as signed
+		{name: "alg HS256", idToken: sign(t, jwt.SigningMethodHS256, idp.Key().PublicKey.N.Bytes(), oidctest.KeyID, with("nonce", "nonce")), want: ErrInvalidIDToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := provider.VerifyIDToken(context.Background(), tt.idToken, "nonce"); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := provider.VerifyIDToken(context.Background(), idp.Sign(idp.IDTokenClaims("nonce")), "nonce"); err != nil {
+		t.Errorf("valid token: %v", err)
+	}
+}
+
+func TestDiscoverRejectsOtherIssuer(t *testing.T) {
+	// a document served by one host cannot name another issuer
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"issuer": "https://idp.example.com", "authorization_endpoint": "https://idp.example.com/authorize",
+			"token_endpoint": "https://idp.example.com/token", "jwks_uri": "https://idp.example.com/jwks"}`))
+	}))
+	defer server.Close()
+
+	if _, err := Discover(context.Background(), Config{IssuerURL: server.URL, ClientID: "app"}, server.Client()); err == nil {
+		t.Error("Discover accepted a document for another issuer")
+	}
+}
@@ -0,0 +1,61 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1" // the corpus is published as SHA-1 hashes
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const breachPrefixLength = 5
+
+// BreachList looks passwords up in a local copy of the Pwned Passwords corpus, split in hash-prefix files
+// the way the k-anonymity range API serves it: the file "<dir>/21BD1.txt" holds the lines "SUFFIX:COUNT"
+// of every breached SHA-1 starting with 21BD1. haveibeenpwned-downloader writes that layout with --single false.
+// Only the file of one prefix is read per check, nothing leaves the machine.
+type BreachList struct {
+	dir string
+}
+
+// NewBreachList checks that dir is a readable directory.
+func NewBreachList(dir string) (*BreachList, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &BreachList{dir: dir}, nil
+}
+
+// Contains reports whether password appears in the corpus. A missing prefix file means no match.
+func (b *BreachList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:breachPrefixLength], hash[breachPrefixLength:]
+
+	f, err := os.Open(filepath.Join(b.dir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineSuffix, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// padding entries of the range API have a count of 0
+		if strings.EqualFold(lineSuffix, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
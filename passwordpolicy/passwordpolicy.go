@@ -0,0 +1,144 @@
+// Package passwordpolicy decides whether a password is good enough to be set on an account.
+package passwordpolicy
+
+import (
+	_ "embed"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Reason codes, stable so clients can translate them.
+const (
+	ReasonTooShort = "too_short"
+	ReasonTooLong  = "too_long"
+	ReasonCommon   = "common"
+	ReasonSimilar  = "similar_to_account"
+	ReasonBreached = "breached"
+)
+
+const (
+	DefaultMinLength = 8
+	DefaultMaxLength = 72 // bcrypt refuses anything longer
+	// account details shorter than this are not worth comparing
+	minSimilarityLength = 3
+)
+
+// Reason explains one way a password fails the policy.
+type Reason struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+//go:embed common-passwords.txt
+var commonPasswordsFile string
+
+var commonPasswords = parseCommonPasswords(commonPasswordsFile)
+
+func parseCommonPasswords(file string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, line := range strings.Split(file, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[strings.ToLower(line)] = struct{}{}
+	}
+	return set
+}
+
+// Policy holds the rules. The zero value only checks the common list and account similarity,
+// use New for the default lengths.
+type Policy struct {
+	MinLength int // in characters
+	MaxLength int // in bytes, 0 means no limit
+	// Breaches is consulted when set, see BreachList.
+	Breaches *BreachList
+}
+
+// New returns a policy with the default lengths and no breach list.
+func New() *Policy {
+	return &Policy{MinLength: DefaultMinLength, MaxLength: DefaultMaxLength}
+}
+
+// Check returns every reason password is refused, none means it is accepted.
+// accountInputs are the username, email... of the account the password is for.
+// The error is only about reading the breach list, the reasons are still valid when it is set.
+func (p *Policy) Check(password string, accountInputs ...string) ([]Reason, error) {
+	var reasons []Reason
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		reasons = append(reasons, Reason{ReasonTooShort, "must be at least " + strconv.Itoa(p.MinLength) + " characters"})
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		reasons = append(reasons, Reason{ReasonTooLong, "must be at most " + strconv.Itoa(p.MaxLength) + " bytes"})
+	}
+	if isCommon(password) {
+		reasons = append(reasons, Reason{ReasonCommon, "is one of the most commonly used passwords"})
+	}
+	if isSimilar(password, accountInputs) {
+		reasons = append(reasons, Reason{ReasonSimilar, "must not contain your username or email"})
+	}
+
+	if p.Breaches == nil {
+		return reasons, nil
+	}
+	breached, err := p.Breaches.Contains(password)
+	if breached {
+		reasons = append(reasons, Reason{ReasonBreached, "has appeared in a data breach"})
+	}
+	return reasons, err
+}
+
+// isCommon also catches the usual decorations of a common password, "Password1!" or "dragon2024".
+func isCommon(password string) bool {
+	lower := strings.ToLower(password)
+	if _, ok := commonPasswords[lower]; ok {
+		return true
+	}
+	stripped := strings.TrimRightFunc(lower, func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+	})
+	if stripped == "" || stripped == lower {
+		return false
+	}
+	_, ok := commonPasswords[stripped]
+	return ok
+}
+
+// isSimilar reports whether the password contains an account detail or is contained in one.
+// Emails are compared by their local part as well, "jane.doe@..." rejects "janedoe".
+func isSimilar(password string, accountInputs []string) bool {
+	normalized := normalize(password)
+	if normalized == "" {
+		return false
+	}
+
+	for _, input := range accountInputs {
+		candidates := []string{input}
+		if local, _, ok := strings.Cut(input, "@"); ok {
+			candidates = append(candidates, local)
+		}
+		for _, candidate := range candidates {
+			candidate = normalize(candidate)
+			if utf8.RuneCountInString(candidate) < minSimilarityLength {
+				continue
+			}
+			if strings.Contains(normalized, candidate) || strings.Contains(candidate, normalized) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalize lowercases s and keeps letters and digits only.
+func normalize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
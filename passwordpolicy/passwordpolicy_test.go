@@ -0,0 +1,133 @@
+package passwordpolicy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// codes returns the reason codes in order, joined by spaces.
+func codes(reasons []Reason) string {
+	var codes []string
+	for _, reason := range reasons {
+		codes = append(codes, reason.Code)
+	}
+	return strings.Join(codes, " ")
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     string
+	}{
+		{name: "accepted", password: "tangerine-Quokka-93"},
+		{name: "too short", password: "Qk9-x", want: ReasonTooShort},
+		{name: "length counts characters", password: "ééééééé", want: ReasonTooShort},
+		{name: "multibyte at the minimum", password: "éééééééé"},
+		{name: "too long", password: strings.Repeat("q", 73), want: ReasonTooLong},
+		{name: "common", password: "password", want: ReasonCommon},
+		{name: "common in another case", password: "PASSWORD", want: ReasonCommon},
+		{name: "common with a suffix", password: "Dragon2024!", want: ReasonCommon},
+		{name: "common with a prefix is not", password: "2024dragon!"},
+		{name: "short and common", password: "dragon", want: ReasonTooShort + " " + ReasonCommon},
+		{name: "username", password: "xX-alice-Xx-99", want: ReasonSimilar},
+		{name: "email local part", password: "JaneDoe-1234", want: ReasonSimilar},
+		{name: "contained in the email", password: "ane.doe@example", want: ReasonSimilar},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reasons, err := New().Check(tt.password, "alice", "jane.doe@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := codes(reasons); got != tt.want {
+				t.Errorf("reasons = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSkipsShortAccountInputs(t *testing.T) {
+	// a two letter username would refuse half the dictionary
+	reasons, err := New().Check("tangerine-Quokka-93", "qu", "", "a@b.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reasons) != 0 {
+		t.Errorf("reasons = %q, want none", codes(reasons))
+	}
+}
+
+func TestZeroPolicy(t *testing.T) {
+	var policy Policy
+	if reasons, _ := policy.Check("x"); len(reasons) != 0 {
+		t.Errorf("reasons = %q, the zero value does not check lengths", codes(reasons))
+	}
+	if reasons, _ := policy.Check("password"); codes(reasons) != ReasonCommon {
+		t.Errorf("reasons = %q, want %q", codes(reasons), ReasonCommon)
+	}
+}
+
+// writeBreachFile writes the prefix file holding password with the given count, in the layout
+// of haveibeenpwned-downloader.
+func writeBreachFile(t *testing.T, dir, password, count string) {
+	t.Helper()
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	lines := "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n" + strings.ToLower(hash[5:]) + ":" + count + "\r\n"
+	if err := os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(lines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBreachList(t *testing.T) {
+	dir := t.TempDir()
+	writeBreachFile(t, dir, "tangerine-Quokka-93", "12")
+	writeBreachFile(t, dir, "padding-Entry-77", "0")
+	breaches, err := NewBreachList(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := New()
+	policy.Breaches = breaches
+
+	tests := []struct {
+		name     string
+		password string
+		want     string
+	}{
+		{name: "breached", password: "tangerine-Quokka-93", want: ReasonBreached},
+		{name: "padding entry", password: "padding-Entry-77"},
+		{name: "no prefix file", password: "Another-Quokka-94"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reasons, err := policy.Check(tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := codes(reasons); got != tt.want {
+				t.Errorf("reasons = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBreachListNeedsADirectory(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "corpus.txt")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewBreachList(filepath.Join(dir, "missing")); err == nil {
+		t.Error("a missing directory was accepted")
+	}
+	if _, err := NewBreachList(file); err == nil {
+		t.Error("a file was accepted")
+	}
+}